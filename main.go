@@ -10,14 +10,20 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/AdmiralBulldogTv/BulldogTax/src/backfill"
+	"github.com/AdmiralBulldogTv/BulldogTax/src/commands"
 	"github.com/AdmiralBulldogTv/BulldogTax/src/configure"
+	"github.com/AdmiralBulldogTv/BulldogTax/src/eventsub"
 	"github.com/AdmiralBulldogTv/BulldogTax/src/global"
 	"github.com/AdmiralBulldogTv/BulldogTax/src/health"
 	"github.com/AdmiralBulldogTv/BulldogTax/src/mongo"
+	"github.com/AdmiralBulldogTv/BulldogTax/src/reconciler"
 	"github.com/AdmiralBulldogTv/BulldogTax/src/redis"
 	"github.com/AdmiralBulldogTv/BulldogTax/src/server"
+	"github.com/AdmiralBulldogTv/BulldogTax/src/tokens"
 	"github.com/bugsnag/panicwrap"
 	"github.com/sirupsen/logrus"
+	"github.com/spf13/pflag"
 )
 
 var (
@@ -98,7 +104,42 @@ func main() {
 		gCtx.Inst().Mongo = mongoInst
 	}
 
+	{
+		tokensInst, err := tokens.New(gCtx)
+		if err != nil {
+			logrus.WithError(err).Fatal("failed to setup tokens")
+		}
+
+		gCtx.Inst().Tokens = tokensInst
+	}
+
+	if args := pflag.Args(); len(args) != 0 {
+		if err := commands.Run(gCtx, args); err != nil {
+			logrus.WithError(err).Fatal("command failed")
+		}
+
+		cancel()
+		os.Exit(0)
+	}
+
+	if gCtx.Config().Backfill.OnStartup {
+		go func() {
+			if err := backfill.Run(gCtx, gCtx, backfill.Options{}); err != nil {
+				logrus.WithError(err).Error("backfill failed")
+			}
+		}()
+	}
+
 	dones := []<-chan struct{}{server.New(gCtx)}
+	if eventsub.Transport(gCtx) == eventsub.TransportWebsocket {
+		dones = append(dones, eventsub.Websocket(gCtx, eventsub.New(gCtx)))
+	}
+	if gCtx.Config().Twitch.EventSub.ReconcileInterval > 0 {
+		dones = append(dones, reconciler.New(gCtx))
+	}
+	if gCtx.Config().Tokens.RefreshInterval > 0 {
+		dones = append(dones, tokens.Refresher(gCtx))
+	}
 	if gCtx.Config().Health.Enabled {
 		dones = append(dones, health.New(gCtx))
 	}
@@ -0,0 +1,133 @@
+package apikeys
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/AdmiralBulldogTv/BulldogTax/src/global"
+	"github.com/AdmiralBulldogTv/BulldogTax/src/mongo"
+	"github.com/AdmiralBulldogTv/BulldogTax/src/structures"
+	"github.com/AdmiralBulldogTv/BulldogTax/src/utils"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// prefix marks our keys, so they are recognised when they leak.
+const prefix = "btx_"
+
+var (
+	ErrUnknownPermission = fmt.Errorf("permissions must be read_results, manage_rules or admin")
+	ErrNoPermissions     = fmt.Errorf("a key needs at least one permission")
+	ErrInvalidKey        = fmt.Errorf("invalid api key")
+)
+
+// Hash is what is stored of a key.
+func Hash(key string) string {
+	sum := sha256.Sum256(utils.S2B(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// ParsePermissions reads a comma separated list of permissions.
+func ParsePermissions(s string) ([]structures.APIKeyPermission, error) {
+	perms := []structures.APIKeyPermission{}
+	for _, p := range strings.Split(s, ",") {
+		p = strings.TrimSpace(p)
+		if p == "" {
+			continue
+		}
+
+		switch perm := structures.APIKeyPermission(p); perm {
+		case structures.APIKeyPermissionReadResults, structures.APIKeyPermissionManageRules, structures.APIKeyPermissionAdmin:
+			perms = append(perms, perm)
+		default:
+			return nil, ErrUnknownPermission
+		}
+	}
+	if len(perms) == 0 {
+		return nil, ErrNoPermissions
+	}
+
+	return perms, nil
+}
+
+// Issue creates a key, the key itself is only returned here and cannot be recovered.
+func Issue(gCtx global.Context, ctx context.Context, name string, broadcasterID string, perms []structures.APIKeyPermission) (string, structures.APIKey, error) {
+	secret, err := utils.GenerateRandomBytes(32)
+	if err != nil {
+		return "", structures.APIKey{}, err
+	}
+	key := prefix + hex.EncodeToString(secret)
+
+	apiKey := structures.APIKey{
+		ID:                primitive.NewObjectID(),
+		Name:              name,
+		Hash:              Hash(key),
+		BroadcasterUserID: broadcasterID,
+		Permissions:       perms,
+		CreatedAt:         time.Now(),
+	}
+	if _, err := gCtx.Inst().Mongo.Collection(mongo.CollectionNameAPIKeys).InsertOne(ctx, apiKey); err != nil {
+		return "", apiKey, err
+	}
+
+	return key, apiKey, nil
+}
+
+// Revoke stops the key with the id from working, false means there is no such key that works.
+func Revoke(gCtx global.Context, ctx context.Context, id primitive.ObjectID) (bool, error) {
+	res, err := gCtx.Inst().Mongo.Collection(mongo.CollectionNameAPIKeys).UpdateOne(ctx, bson.M{
+		"_id":        id,
+		"revoked_at": bson.M{"$exists": false},
+	}, bson.M{
+		"$set": bson.M{
+			"revoked_at": time.Now(),
+		},
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return res.ModifiedCount != 0, nil
+}
+
+// Lookup finds the key that has not been revoked, ErrInvalidKey when there is none.
+func Lookup(gCtx global.Context, ctx context.Context, key string) (structures.APIKey, error) {
+	apiKey := structures.APIKey{}
+	if !strings.HasPrefix(key, prefix) {
+		return apiKey, ErrInvalidKey
+	}
+
+	res := gCtx.Inst().Mongo.Collection(mongo.CollectionNameAPIKeys).FindOne(ctx, bson.M{
+		"hash":       Hash(key),
+		"revoked_at": bson.M{"$exists": false},
+	})
+	err := res.Err()
+	if err == nil {
+		err = res.Decode(&apiKey)
+	}
+	if err == mongo.ErrNoDocuments {
+		err = ErrInvalidKey
+	}
+
+	return apiKey, err
+}
+
+// Can reports whether the key has the permission, admin keys have all of them.
+func Can(key structures.APIKey, perm structures.APIKeyPermission) bool {
+	for _, p := range key.Permissions {
+		if p == perm || p == structures.APIKeyPermissionAdmin {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Allows reports whether the key reaches the data of the broadcaster.
+func Allows(key structures.APIKey, broadcasterID string) bool {
+	return key.BroadcasterUserID == "" || key.BroadcasterUserID == broadcasterID
+}
@@ -0,0 +1,41 @@
+package apikeys
+
+import (
+	"testing"
+
+	"github.com/AdmiralBulldogTv/BulldogTax/src/structures"
+)
+
+func TestParsePermissions(t *testing.T) {
+	tests := []struct {
+		name string
+		s    string
+		want []structures.APIKeyPermission
+		err  error
+	}{
+		{"one", "read_results", []structures.APIKeyPermission{structures.APIKeyPermissionReadResults}, nil},
+		{"several", "read_results,manage_rules", []structures.APIKeyPermission{structures.APIKeyPermissionReadResults, structures.APIKeyPermissionManageRules}, nil},
+		{"spaces and empty parts", " admin , ,read_results,", []structures.APIKeyPermission{structures.APIKeyPermissionAdmin, structures.APIKeyPermissionReadResults}, nil},
+		{"unknown", "read_results,write_results", nil, ErrUnknownPermission},
+		{"case sensitive", "Admin", nil, ErrUnknownPermission},
+		{"empty", "", nil, ErrNoPermissions},
+		{"only commas", " , ", nil, ErrNoPermissions},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			perms, err := ParsePermissions(tt.s)
+			if err != tt.err {
+				t.Fatalf("ParsePermissions() err = %v, want %v", err, tt.err)
+			}
+			if len(perms) != len(tt.want) {
+				t.Fatalf("ParsePermissions() = %v, want %v", perms, tt.want)
+			}
+			for i := range perms {
+				if perms[i] != tt.want[i] {
+					t.Errorf("ParsePermissions() = %v, want %v", perms, tt.want)
+				}
+			}
+		})
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"github.com/AdmiralBulldogTv/BulldogTax/src/global"
+	"github.com/AdmiralBulldogTv/BulldogTax/src/twitch"
 	"github.com/nicklaw5/helix"
 	"github.com/sirupsen/logrus"
 )
@@ -23,6 +24,7 @@ func GetAuth(gCtx global.Context, ctx context.Context) (string, error) {
 	api, err := helix.NewClient(&helix.Options{
 		ClientID:     gCtx.Config().Twitch.ClientID,
 		ClientSecret: gCtx.Config().Twitch.ClientSecret,
+		APIBaseURL:   twitch.APIURL(gCtx),
 	})
 	if err != nil {
 		return "", err
@@ -0,0 +1,199 @@
+package backfill
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/AdmiralBulldogTv/BulldogTax/src/feed"
+	"github.com/AdmiralBulldogTv/BulldogTax/src/global"
+	"github.com/AdmiralBulldogTv/BulldogTax/src/ledger"
+	"github.com/AdmiralBulldogTv/BulldogTax/src/mongo"
+	"github.com/AdmiralBulldogTv/BulldogTax/src/structures"
+	"github.com/AdmiralBulldogTv/BulldogTax/src/taxes"
+	"github.com/AdmiralBulldogTv/BulldogTax/src/twitch"
+	"github.com/nicklaw5/helix"
+	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ErrNoTokens is returned when there is no store to get the tokens of broadcasters from.
+var ErrNoTokens = fmt.Errorf("no broadcaster token store")
+
+// DefaultWindow is how far back redemptions are fetched when no window is configured.
+const DefaultWindow = time.Hour * 24 * 7
+
+type Options struct {
+	// BroadcasterID limits the backfill to one broadcaster, otherwise every active broadcaster is backfilled.
+	BroadcasterID string
+	// Since is the oldest redemption to fetch.
+	Since time.Time
+}
+
+// Run fetches the redemptions of every reward we manage for the broadcasters from helix,
+// and stores the ones missing from redeem_rewards, matched on their twitch id.
+func Run(gCtx global.Context, ctx context.Context, opts Options) error {
+	if gCtx.Inst().Tokens == nil {
+		return ErrNoTokens
+	}
+
+	if opts.Since.IsZero() {
+		window := gCtx.Config().Backfill.Window
+		if window == 0 {
+			window = DefaultWindow
+		}
+		opts.Since = time.Now().Add(-window)
+	}
+
+	filter := bson.M{
+		"status": structures.BroadcasterStatusActive,
+	}
+	if opts.BroadcasterID != "" {
+		filter = bson.M{
+			"user_id": opts.BroadcasterID,
+		}
+	}
+
+	cur, err := gCtx.Inst().Mongo.Collection(mongo.CollectionNameBroadcasters).Find(ctx, filter)
+	broadcasters := []structures.Broadcaster{}
+	if err == nil {
+		err = cur.All(ctx, &broadcasters)
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, broadcaster := range broadcasters {
+		inserted, err := broadcasterRedemptions(gCtx, ctx, broadcaster.UserID, opts.Since)
+		if err != nil {
+			logrus.Errorf("backfill, broadcaster=%s err=%v", broadcaster.UserID, err)
+			continue
+		}
+
+		logrus.Infof("backfill, broadcaster=%s inserted=%d", broadcaster.UserID, inserted)
+	}
+
+	return nil
+}
+
+func broadcasterRedemptions(gCtx global.Context, ctx context.Context, userID string, since time.Time) (int64, error) {
+	token, err := gCtx.Inst().Tokens.AccessToken(ctx, userID)
+	if err != nil {
+		return 0, err
+	}
+
+	api, err := helix.NewClient(&helix.Options{
+		ClientID:        gCtx.Config().Twitch.ClientID,
+		APIBaseURL:      twitch.APIURL(gCtx),
+		UserAccessToken: token,
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	// redemptions can only be read for rewards created by our client id.
+	rewards, err := api.GetCustomRewards(&helix.GetCustomRewardsParams{
+		BroadcasterID:         userID,
+		OnlyManageableRewards: true,
+	})
+	if err != nil || rewards.Error != "" {
+		if err == nil {
+			err = fmt.Errorf("%s %s %d", rewards.Error, rewards.ErrorMessage, rewards.ErrorStatus)
+		}
+		return 0, err
+	}
+
+	var inserted int64
+	for _, reward := range rewards.Data.ChannelCustomRewards {
+		for _, status := range []string{twitch.RedemptionStatusUnfulfilled, twitch.RedemptionStatusFulfilled, twitch.RedemptionStatusCanceled} {
+			n, err := rewardRedemptions(gCtx, ctx, token, userID, reward.ID, status, since)
+			inserted += n
+			if err != nil {
+				return inserted, err
+			}
+		}
+	}
+
+	return inserted, nil
+}
+
+func rewardRedemptions(gCtx global.Context, ctx context.Context, token string, userID string, rewardID string, status string, since time.Time) (int64, error) {
+	params := twitch.RedemptionsParams{
+		BroadcasterID: userID,
+		RewardID:      rewardID,
+		Status:        status,
+		Sort:          "NEWEST",
+		First:         50,
+	}
+
+	var inserted int64
+	for {
+		resp, err := twitch.GetRedemptions(gCtx, ctx, token, params)
+		if err != nil {
+			return inserted, err
+		}
+
+		for _, r := range resp.Data {
+			if r.RedeemedAt.Before(since) {
+				return inserted, nil
+			}
+
+			ev := structures.RedeemEvent{
+				TwitchID:          r.ID,
+				BroadcasterUserID: r.BroadcasterID,
+				BroadcasterLogin:  r.BroadcasterLogin,
+				RewardID:          r.Reward.ID,
+				RewardName:        r.Reward.Title,
+				UserID:            r.UserID,
+				UserName:          r.UserName,
+				Cost:              int32(r.Reward.Cost),
+				Status:            structures.RedeemStatus(strings.ToLower(r.Status)),
+				RedeemedAt:        r.RedeemedAt,
+			}
+
+			res, err := gCtx.Inst().Mongo.Collection(mongo.CollectionNameRedeemRewards).UpdateOne(ctx, bson.M{
+				"twitch_id": r.ID,
+			}, bson.M{
+				"$setOnInsert": ev,
+			}, options.Update().SetUpsert(true))
+			if err != nil {
+				return inserted, err
+			}
+
+			inserted += res.UpsertedCount
+			if res.UpsertedCount == 0 {
+				continue
+			}
+
+			if err := ledger.RecordRedemption(gCtx, ctx, userID, ev); err != nil {
+				return inserted, err
+			}
+			// helix does not say when it was canceled.
+			if ev.Status == structures.RedeemStatusCanceled {
+				if err := ledger.RecordRefund(gCtx, ctx, userID, ev, ev.RedeemedAt); err != nil {
+					return inserted, err
+				}
+			}
+
+			// feed clients that were connected while it was missed get it now, the others read it back when they resume.
+			if id, ok := res.UpsertedID.(primitive.ObjectID); ok {
+				ev.ID = id
+				if err := feed.PublishRedemption(gCtx, ctx, ev); err != nil {
+					logrus.Errorf("redis, err=%v", err)
+				}
+			}
+
+			if err := taxes.PublishCompliance(gCtx, ctx, userID, ev.RewardID, ev.UserID, ev.RedeemedAt); err != nil {
+				logrus.Errorf("taxes, err=%v", err)
+			}
+		}
+
+		if resp.Pagination.Cursor == "" || len(resp.Data) == 0 {
+			return inserted, nil
+		}
+		params.After = resp.Pagination.Cursor
+	}
+}
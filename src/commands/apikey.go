@@ -0,0 +1,70 @@
+package commands
+
+import (
+	"fmt"
+
+	"github.com/AdmiralBulldogTv/BulldogTax/src/apikeys"
+	"github.com/AdmiralBulldogTv/BulldogTax/src/global"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/pflag"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var ErrUsageAPIKey = fmt.Errorf("usage: apikey issue --name <name> --permissions <permissions> [--broadcaster <id>] | apikey revoke <id>")
+
+// APIKey issues and revokes api keys. An issued key is printed once, only its hash is stored.
+func APIKey(gCtx global.Context, args []string) error {
+	if len(args) == 0 {
+		return ErrUsageAPIKey
+	}
+
+	switch args[0] {
+	case "issue":
+		flags := pflag.NewFlagSet("apikey issue", pflag.ContinueOnError)
+		name := flags.String("name", "", "What the key is for")
+		broadcasterID := flags.String("broadcaster", "", "Limit the key to the broadcaster with the user id")
+		permissions := flags.String("permissions", "", "Comma separated read_results, manage_rules or admin")
+		if err := flags.Parse(args[1:]); err != nil {
+			return err
+		}
+		if *name == "" {
+			return ErrUsageAPIKey
+		}
+
+		perms, err := apikeys.ParsePermissions(*permissions)
+		if err != nil {
+			return err
+		}
+
+		key, apiKey, err := apikeys.Issue(gCtx, gCtx, *name, *broadcasterID, perms)
+		if err != nil {
+			return err
+		}
+
+		logrus.Infof("apikey, issued id=%s name=%s broadcaster=%s permissions=%v", apiKey.ID.Hex(), apiKey.Name, apiKey.BroadcasterUserID, apiKey.Permissions)
+		fmt.Println(key)
+	case "revoke":
+		if len(args) != 2 {
+			return ErrUsageAPIKey
+		}
+
+		id, err := primitive.ObjectIDFromHex(args[1])
+		if err != nil {
+			return err
+		}
+
+		ok, err := apikeys.Revoke(gCtx, gCtx, id)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return fmt.Errorf("%w: %s", apikeys.ErrInvalidKey, args[1])
+		}
+
+		logrus.Infof("apikey, revoked id=%s", args[1])
+	default:
+		return ErrUsageAPIKey
+	}
+
+	return nil
+}
@@ -0,0 +1,32 @@
+package commands
+
+import (
+	"time"
+
+	"github.com/AdmiralBulldogTv/BulldogTax/src/backfill"
+	"github.com/AdmiralBulldogTv/BulldogTax/src/global"
+	"github.com/spf13/pflag"
+)
+
+// Backfill stores redemptions missing from redeem_rewards by fetching them from helix.
+func Backfill(gCtx global.Context, args []string) error {
+	flags := pflag.NewFlagSet("backfill", pflag.ContinueOnError)
+	broadcaster := flags.String("broadcaster", "", "Only backfill this broadcaster id")
+	since := flags.String("since", "", "Fetch redemptions back to this RFC3339 time, defaults to backfill.window")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	opts := backfill.Options{
+		BroadcasterID: *broadcaster,
+	}
+	if *since != "" {
+		t, err := time.Parse(time.RFC3339, *since)
+		if err != nil {
+			return err
+		}
+		opts.Since = t
+	}
+
+	return backfill.Run(gCtx, gCtx, opts)
+}
@@ -0,0 +1,30 @@
+package commands
+
+import (
+	"fmt"
+
+	"github.com/AdmiralBulldogTv/BulldogTax/src/global"
+)
+
+var ErrUnknownCommand = fmt.Errorf("unknown command")
+
+type command func(gCtx global.Context, args []string) error
+
+var commands = map[string]command{
+	"apikey":               APIKey,
+	"backfill":             Backfill,
+	"migrate-broadcasters": MigrateBroadcasters,
+	"rebuild-ledger":       RebuildLedger,
+	"replay":               Replay,
+	"rotate-secret":        RotateSecret,
+}
+
+// Run executes the subcommand named by the first argument with the remaining arguments.
+func Run(gCtx global.Context, args []string) error {
+	cmd, ok := commands[args[0]]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrUnknownCommand, args[0])
+	}
+
+	return cmd(gCtx, args[1:])
+}
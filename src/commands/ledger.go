@@ -0,0 +1,22 @@
+package commands
+
+import (
+	"github.com/AdmiralBulldogTv/BulldogTax/src/global"
+	"github.com/AdmiralBulldogTv/BulldogTax/src/ledger"
+	"github.com/AdmiralBulldogTv/BulldogTax/src/redemptions"
+	"github.com/AdmiralBulldogTv/BulldogTax/src/structures"
+	"github.com/spf13/pflag"
+)
+
+// RebuildLedger enters every stored redemption and adjustment in a fresh ledger.
+func RebuildLedger(gCtx global.Context, args []string) error {
+	flags := pflag.NewFlagSet("rebuild-ledger", pflag.ContinueOnError)
+	broadcaster := flags.String("broadcaster", "", "Only rebuild the ledger of this broadcaster id")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	return ledger.Rebuild(gCtx, gCtx, *broadcaster, func(ev structures.RedeemEvent) (string, error) {
+		return redemptions.Broadcaster(gCtx, gCtx, ev)
+	})
+}
@@ -0,0 +1,88 @@
+package commands
+
+import (
+	"github.com/AdmiralBulldogTv/BulldogTax/src/global"
+	"github.com/AdmiralBulldogTv/BulldogTax/src/mongo"
+	"github.com/AdmiralBulldogTv/BulldogTax/src/redemptions"
+	"github.com/AdmiralBulldogTv/BulldogTax/src/structures"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/pflag"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// MigrateBroadcasters stores the broadcaster on redemptions stored before it was recorded,
+// finding it through their raw events, or their reward for backfilled ones.
+func MigrateBroadcasters(gCtx global.Context, args []string) error {
+	flags := pflag.NewFlagSet("migrate-broadcasters", pflag.ContinueOnError)
+	dryRun := flags.Bool("dry-run", false, "Only report what would be migrated")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	logins := map[string]string{}
+	cur, err := gCtx.Inst().Mongo.Collection(mongo.CollectionNameBroadcasters).Find(gCtx, bson.M{})
+	broadcasters := []structures.Broadcaster{}
+	if err == nil {
+		err = cur.All(gCtx, &broadcasters)
+	}
+	if err != nil {
+		return err
+	}
+	for _, b := range broadcasters {
+		logins[b.UserID] = b.Login
+	}
+
+	cur, err = gCtx.Inst().Mongo.Collection(mongo.CollectionNameRedeemRewards).Find(gCtx, bson.M{
+		"$or": bson.A{
+			bson.M{"broadcaster_user_id": bson.M{"$exists": false}},
+			bson.M{"broadcaster_user_id": ""},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	defer cur.Close(gCtx)
+
+	var migrated, unknown int
+	for cur.Next(gCtx) {
+		ev := structures.RedeemEvent{}
+		if err := cur.Decode(&ev); err != nil {
+			return err
+		}
+
+		id, err := redemptions.Broadcaster(gCtx, gCtx, ev)
+		if err != nil {
+			if err != redemptions.ErrUnknownBroadcaster {
+				return err
+			}
+			unknown++
+			logrus.Warnf("migrate, unknown broadcaster redemption=%s reward=%s", ev.TwitchID, ev.RewardID)
+			continue
+		}
+
+		if !*dryRun {
+			set := bson.M{
+				"broadcaster_user_id": id,
+			}
+			if login := logins[id]; login != "" {
+				set["broadcaster_login"] = login
+			}
+
+			if _, err := gCtx.Inst().Mongo.Collection(mongo.CollectionNameRedeemRewards).UpdateOne(gCtx, bson.M{
+				"_id": ev.ID,
+			}, bson.M{
+				"$set": set,
+			}); err != nil {
+				return err
+			}
+		}
+		migrated++
+	}
+	if err := cur.Err(); err != nil {
+		return err
+	}
+
+	logrus.Infof("migrate, migrated=%d unknown=%d dry_run=%v", migrated, unknown, *dryRun)
+
+	return nil
+}
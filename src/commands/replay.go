@@ -0,0 +1,93 @@
+package commands
+
+import (
+	"time"
+
+	"github.com/AdmiralBulldogTv/BulldogTax/src/eventsub"
+	"github.com/AdmiralBulldogTv/BulldogTax/src/global"
+	"github.com/AdmiralBulldogTv/BulldogTax/src/mongo"
+	"github.com/AdmiralBulldogTv/BulldogTax/src/structures"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/pflag"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Replay re-processes stored notifications through the same dispatcher the webhook uses.
+// Redemptions are upserted on their twitch id, so replaying never creates duplicates.
+func Replay(gCtx global.Context, args []string) error {
+	flags := pflag.NewFlagSet("replay", pflag.ContinueOnError)
+	broadcaster := flags.String("broadcaster", "", "Only replay events of this broadcaster id")
+	since := flags.String("since", "", "Only replay events received at or after this RFC3339 time")
+	until := flags.String("until", "", "Only replay events received at or before this RFC3339 time")
+	messageIDs := flags.StringSlice("message-id", nil, "Only replay these message ids")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	filter := bson.M{
+		"message_type": eventsub.MessageTypeNotification,
+	}
+	if *broadcaster != "" {
+		filter["broadcaster_user_id"] = *broadcaster
+	}
+	if len(*messageIDs) != 0 {
+		filter["message_id"] = bson.M{"$in": *messageIDs}
+	}
+
+	receivedAt := bson.M{}
+	if *since != "" {
+		t, err := time.Parse(time.RFC3339, *since)
+		if err != nil {
+			return err
+		}
+		receivedAt["$gte"] = t
+	}
+	if *until != "" {
+		t, err := time.Parse(time.RFC3339, *until)
+		if err != nil {
+			return err
+		}
+		receivedAt["$lte"] = t
+	}
+	if len(receivedAt) != 0 {
+		filter["received_at"] = receivedAt
+	}
+
+	cur, err := gCtx.Inst().Mongo.Collection(mongo.CollectionNameRawEvents).Find(gCtx, filter, options.Find().SetSort(bson.D{
+		{Key: "received_at", Value: 1},
+	}))
+	if err != nil {
+		return err
+	}
+	defer cur.Close(gCtx)
+
+	dispatcher := eventsub.New(gCtx)
+
+	var replayed, failed int
+	for cur.Next(gCtx) {
+		raw := structures.RawEvent{}
+		if err := cur.Decode(&raw); err != nil {
+			return err
+		}
+
+		msg, err := eventsub.ParseRaw(raw)
+		if err == nil {
+			_, err = dispatcher.Dispatch(gCtx, msg)
+		}
+		if err != nil {
+			failed++
+			logrus.Errorf("replay, message_id=%s err=%v", raw.MessageID, err)
+			continue
+		}
+
+		replayed++
+	}
+	if err := cur.Err(); err != nil {
+		return err
+	}
+
+	logrus.Infof("replay, replayed=%d failed=%d", replayed, failed)
+
+	return nil
+}
@@ -0,0 +1,88 @@
+package commands
+
+import (
+	"github.com/AdmiralBulldogTv/BulldogTax/src/auth"
+	"github.com/AdmiralBulldogTv/BulldogTax/src/eventsub"
+	"github.com/AdmiralBulldogTv/BulldogTax/src/global"
+	"github.com/AdmiralBulldogTv/BulldogTax/src/mongo"
+	"github.com/AdmiralBulldogTv/BulldogTax/src/structures"
+	"github.com/AdmiralBulldogTv/BulldogTax/src/twitch"
+	"github.com/nicklaw5/helix"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/pflag"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// RotateSecret recreates every webhook subscription still verified with a configured secret, giving it a secret
+// of its own, then reports which configured secrets are unused and can be removed from twitch.webhook_secrets.
+// With --all the subscriptions that already have their own secret get a new one as well.
+func RotateSecret(gCtx global.Context, args []string) error {
+	flags := pflag.NewFlagSet("rotate-secret", pflag.ContinueOnError)
+	all := flags.Bool("all", false, "Also rotate subscriptions that have their own secret")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	tkn, err := auth.GetAuth(gCtx, gCtx)
+	if err != nil {
+		return err
+	}
+
+	api, err := helix.NewClient(&helix.Options{
+		ClientID:       gCtx.Config().Twitch.ClientID,
+		ClientSecret:   gCtx.Config().Twitch.ClientSecret,
+		APIBaseURL:     twitch.APIURL(gCtx),
+		AppAccessToken: tkn,
+	})
+	if err != nil {
+		return err
+	}
+
+	filter := bson.M{
+		"transport": bson.M{"$ne": eventsub.TransportWebsocket},
+	}
+	if !*all {
+		filter["secret"] = bson.M{"$exists": false}
+	}
+
+	cur, err := gCtx.Inst().Mongo.Collection(mongo.CollectionNameWebhooks).Find(gCtx, filter)
+
+	whs := []structures.WebHook{}
+	if err == nil {
+		err = cur.All(gCtx, &whs)
+	}
+	if err != nil {
+		return err
+	}
+
+	var failed int
+	for _, wh := range whs {
+		if _, err := eventsub.Resubscribe(gCtx, gCtx, api, wh); err != nil {
+			failed++
+			logrus.Errorf("rotate-secret, user=%s type=%s err=%v", wh.UserID, wh.Type, err)
+		}
+	}
+
+	logrus.Infof("rotate-secret, rotated=%d failed=%d", len(whs)-failed, failed)
+
+	for i, secret := range eventsub.Secrets(gCtx) {
+		id := eventsub.SecretID(secret)
+
+		count, err := gCtx.Inst().Mongo.Collection(mongo.CollectionNameWebhooks).CountDocuments(gCtx, bson.M{
+			"transport": bson.M{"$ne": eventsub.TransportWebsocket},
+			"secret":    bson.M{"$exists": false},
+			"secret_id": id,
+		})
+		if err != nil {
+			return err
+		}
+
+		if count == 0 {
+			logrus.Infof("rotate-secret, secret %d (%s) is retired and can be removed from the config", i, id)
+		} else {
+			logrus.Warnf("rotate-secret, secret %d (%s) is still used by %d subscriptions", i, id, count)
+		}
+	}
+
+	return nil
+}
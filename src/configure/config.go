@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"reflect"
 	"strings"
+	"time"
 
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/pflag"
@@ -32,6 +33,8 @@ func New() *Config {
 
 	pflag.String("config", "config.yaml", "Config file location")
 	pflag.Bool("noheader", false, "Disable the startup header")
+	// everything after the first non-flag argument belongs to a subcommand.
+	pflag.CommandLine.SetInterspersed(false)
 	pflag.Parse()
 	checkErr(config.BindPFlags(pflag.CommandLine))
 
@@ -102,8 +105,44 @@ type Config struct {
 		ClientSecret  string `mapstructure:"client_secret" json:"client_secret"`
 		RedirectURI   string `mapstructure:"redirect_uri" json:"redirect_uri"`
 		WebhookSecret string `mapstructure:"webhook_secret" json:"webhook_secret"`
+		// WebhookSecrets are tried in order when verifying subscriptions that have no secret of their own.
+		WebhookSecrets []string `mapstructure:"webhook_secrets" json:"webhook_secrets"`
+		APIURL         string   `mapstructure:"api_url" json:"api_url"`
+
+		EventSub struct {
+			Transport    string `mapstructure:"transport" json:"transport"`
+			WebsocketURL string `mapstructure:"websocket_url" json:"websocket_url"`
+
+			ReconcileInterval time.Duration `mapstructure:"reconcile_interval" json:"reconcile_interval"`
+		} `mapstructure:"eventsub" json:"eventsub"`
 	} `mapstructure:"twitch" json:"twitch"`
 
+	Redemptions struct {
+		AutoFulfill struct {
+			Enabled bool `mapstructure:"enabled" json:"enabled"`
+			// RewardIDs limits the rule to these rewards, every reward we manage is fulfilled when empty.
+			RewardIDs []string `mapstructure:"reward_ids" json:"reward_ids"`
+		} `mapstructure:"auto_fulfill" json:"auto_fulfill"`
+	} `mapstructure:"redemptions" json:"redemptions"`
+
+	Backfill struct {
+		OnStartup bool          `mapstructure:"on_startup" json:"on_startup"`
+		Window    time.Duration `mapstructure:"window" json:"window"`
+	} `mapstructure:"backfill" json:"backfill"`
+
+	Tokens struct {
+		// Key encrypts the user tokens of broadcasters, encryption.key is used when it is empty.
+		Key string `mapstructure:"key" json:"key"`
+		// RefreshBefore is how long before their expiry tokens are refreshed.
+		RefreshBefore   time.Duration `mapstructure:"refresh_before" json:"refresh_before"`
+		RefreshInterval time.Duration `mapstructure:"refresh_interval" json:"refresh_interval"`
+	} `mapstructure:"tokens" json:"tokens"`
+
+	Encryption struct {
+		// Key is a base64 encoded 32 byte key used to encrypt secrets at rest.
+		Key string `mapstructure:"key" json:"key"`
+	} `mapstructure:"encryption" json:"encryption"`
+
 	Frontend struct {
 		CookieSecure bool   `mapstructure:"cookie_secure" json:"cookie_secure"`
 		CookieDomain string `mapstructure:"cookie_domain" json:"cookie_domain"`
@@ -111,7 +150,8 @@ type Config struct {
 	} `mapstructure:"frontend" json:"frontend"`
 
 	API struct {
-		Bind string `mapstructure:"bind" json:"bind"`
+		Bind     string `mapstructure:"bind" json:"bind"`
+		AdminKey string `mapstructure:"admin_key" json:"admin_key"`
 	} `mapstructure:"api" json:"api"`
 
 	Health struct {
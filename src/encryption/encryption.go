@@ -0,0 +1,75 @@
+package encryption
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/base64"
+	"fmt"
+
+	"github.com/AdmiralBulldogTv/BulldogTax/src/global"
+	"github.com/AdmiralBulldogTv/BulldogTax/src/utils"
+)
+
+var (
+	ErrInvalidKey        = fmt.Errorf("encryption key must be 32 bytes, base64 encoded")
+	ErrInvalidCiphertext = fmt.Errorf("invalid ciphertext")
+)
+
+// Key returns the configured key used to encrypt secrets at rest.
+func Key(gCtx global.Context) ([]byte, error) {
+	return ParseKey(gCtx.Config().Encryption.Key)
+}
+
+// ParseKey decodes a base64 encoded 32 byte key.
+func ParseKey(s string) ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(s)
+	if err != nil || len(key) != 32 {
+		return nil, ErrInvalidKey
+	}
+
+	return key, nil
+}
+
+// Encrypt seals plaintext with AES-256-GCM, the result is base64 encoded and prefixed with its nonce.
+func Encrypt(key []byte, plaintext string) (string, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+
+	nonce, err := utils.GenerateRandomBytes(gcm.NonceSize())
+	if err != nil {
+		return "", err
+	}
+
+	return base64.StdEncoding.EncodeToString(gcm.Seal(nonce, nonce, utils.S2B(plaintext), nil)), nil
+}
+
+// Decrypt opens a ciphertext created by Encrypt.
+func Decrypt(key []byte, ciphertext string) (string, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+
+	data, err := base64.StdEncoding.DecodeString(ciphertext)
+	if err != nil || len(data) < gcm.NonceSize() {
+		return "", ErrInvalidCiphertext
+	}
+
+	plaintext, err := gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], nil)
+	if err != nil {
+		return "", ErrInvalidCiphertext
+	}
+
+	return string(plaintext), nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, ErrInvalidKey
+	}
+
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,63 @@
+package eventsub
+
+import (
+	"context"
+	"time"
+
+	"github.com/AdmiralBulldogTv/BulldogTax/src/global"
+	"github.com/AdmiralBulldogTv/BulldogTax/src/mongo"
+	"github.com/AdmiralBulldogTv/BulldogTax/src/structures"
+	"github.com/nicklaw5/helix"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// RegisterBroadcaster records a broadcaster that authorized us, clearing an earlier revocation.
+func RegisterBroadcaster(gCtx global.Context, ctx context.Context, user helix.User) error {
+	_, err := gCtx.Inst().Mongo.Collection(mongo.CollectionNameBroadcasters).UpdateOne(ctx, bson.M{
+		"user_id": user.ID,
+	}, bson.M{
+		"$set": bson.M{
+			"login":        user.Login,
+			"display_name": user.DisplayName,
+			"status":       structures.BroadcasterStatusActive,
+			"updated_at":   time.Now(),
+		},
+		"$unset": bson.M{
+			"revoked_at": "",
+		},
+		"$setOnInsert": bson.M{
+			"created_at": time.Now(),
+		},
+	}, options.Update().SetUpsert(true))
+
+	return err
+}
+
+// RevokeBroadcaster marks the broadcaster as revoked and drops their webhook documents and tokens,
+// twitch has already removed the subscriptions. Their redemptions are kept.
+func RevokeBroadcaster(gCtx global.Context, ctx context.Context, userID string) error {
+	if _, err := gCtx.Inst().Mongo.Collection(mongo.CollectionNameBroadcasters).UpdateOne(ctx, bson.M{
+		"user_id": userID,
+	}, bson.M{
+		"$set": bson.M{
+			"status":     structures.BroadcasterStatusRevoked,
+			"updated_at": time.Now(),
+			"revoked_at": time.Now(),
+		},
+		"$setOnInsert": bson.M{
+			"created_at": time.Now(),
+		},
+	}, options.Update().SetUpsert(true)); err != nil {
+		return err
+	}
+
+	if _, err := gCtx.Inst().Mongo.Collection(mongo.CollectionNameWebhooks).DeleteMany(ctx, bson.M{
+		"user_id": userID,
+	}); err != nil {
+		return err
+	}
+
+	// the tokens were revoked along with the authorization.
+	return gCtx.Inst().Tokens.Delete(ctx, userID)
+}
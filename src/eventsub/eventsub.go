@@ -0,0 +1,212 @@
+package eventsub
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/AdmiralBulldogTv/BulldogTax/src/global"
+	jsoniter "github.com/json-iterator/go"
+	"github.com/nicklaw5/helix"
+	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	TransportWebhook   = "webhook"
+	TransportWebsocket = "websocket"
+)
+
+const (
+	MessageTypeVerification = "webhook_callback_verification"
+	MessageTypeNotification = "notification"
+	MessageTypeRevocation   = "revocation"
+)
+
+var (
+	ErrUnknownMessageType = fmt.Errorf("unknown eventsub message type")
+	ErrInvalidMessage     = fmt.Errorf("invalid eventsub message")
+)
+
+var json = jsoniter.ConfigCompatibleWithStandardLibrary
+
+// Message is a single EventSub delivery, independent of the transport it arrived on.
+type Message struct {
+	ID           string
+	Type         string
+	Timestamp    time.Time
+	Subscription helix.EventSubSubscription
+	Challenge    string
+	Event        jsoniter.RawMessage
+
+	// RawEventID is the stored delivery this message was parsed from, if it was stored.
+	RawEventID primitive.ObjectID
+}
+
+type webhookBody struct {
+	Challenge    string                     `json:"challenge"`
+	Subscription helix.EventSubSubscription `json:"subscription"`
+	Event        jsoniter.RawMessage        `json:"event"`
+}
+
+// ParseWebhook builds a Message from the headers and body of a webhook delivery.
+func ParseWebhook(header func(key string) string, body []byte) (*Message, error) {
+	t, err := time.Parse(time.RFC3339, header("Twitch-Eventsub-Message-Timestamp"))
+	if err != nil {
+		return nil, ErrInvalidMessage
+	}
+
+	msg := &Message{
+		ID:        header("Twitch-Eventsub-Message-Id"),
+		Type:      header("Twitch-Eventsub-Message-Type"),
+		Timestamp: t,
+	}
+	if msg.ID == "" {
+		return nil, ErrInvalidMessage
+	}
+
+	wb := webhookBody{}
+	if err := json.Unmarshal(body, &wb); err != nil {
+		return nil, ErrInvalidMessage
+	}
+
+	msg.Challenge = wb.Challenge
+	msg.Subscription = wb.Subscription
+	msg.Event = wb.Event
+
+	return msg, nil
+}
+
+// EventBroadcasterUserID returns the broadcaster_user_id of the event, empty when the message carries no event.
+func (m *Message) EventBroadcasterUserID() (string, error) {
+	if len(m.Event) == 0 || string(m.Event) == "null" {
+		return "", nil
+	}
+
+	ev := struct {
+		BroadcasterUserID string `json:"broadcaster_user_id"`
+	}{}
+	if err := json.Unmarshal(m.Event, &ev); err != nil {
+		return "", ErrInvalidMessage
+	}
+
+	return ev.BroadcasterUserID, nil
+}
+
+// NotificationHandler processes the event of a notification for a single subscription type.
+type NotificationHandler func(gCtx global.Context, ctx context.Context, msg *Message) error
+
+// Dispatcher routes messages by their message type, and notifications by their subscription type.
+type Dispatcher struct {
+	gCtx global.Context
+
+	mtx      sync.RWMutex
+	handlers map[string]NotificationHandler
+}
+
+// New returns a Dispatcher with the handlers for every event type we subscribe to.
+func New(gCtx global.Context) *Dispatcher {
+	d := &Dispatcher{
+		gCtx:     gCtx,
+		handlers: map[string]NotificationHandler{},
+	}
+
+	d.Register(helix.EventSubTypeChannelPointsCustomRewardRedemptionAdd, RedemptionAdd)
+	d.Register(helix.EventSubTypeChannelPointsCustomRewardRedemptionUpdate, RedemptionUpdate)
+
+	return d
+}
+
+// Register sets the handler for notifications of the given subscription type.
+func (d *Dispatcher) Register(subscriptionType string, handler NotificationHandler) {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+
+	d.handlers[subscriptionType] = handler
+}
+
+// Process claims, stores and dispatches a delivery, this is the path every transport feeds into.
+// Deliveries that were already claimed are acknowledged without processing them again.
+func (d *Dispatcher) Process(ctx context.Context, msg *Message, transport string, headers map[string]string, body []byte) (string, error) {
+	key := fmt.Sprintf("twitch:events:%s:%s:%s", msg.Subscription.Type, msg.Subscription.Condition.BroadcasterUserID, msg.ID)
+	set, err := d.gCtx.Inst().Redis.SetNX(ctx, key, "1", time.Hour)
+	if err != nil {
+		return "", err
+	}
+	if !set {
+		logrus.Errorf("duplicate event key=%s", key)
+		return "", nil
+	}
+
+	resp, err := func() (string, error) {
+		if err := StoreRaw(d.gCtx, ctx, msg, transport, headers, body); err != nil {
+			return "", err
+		}
+
+		return d.Dispatch(ctx, msg)
+	}()
+	if err != nil {
+		// release the claim so a redelivery gets processed.
+		if err := d.gCtx.Inst().Redis.Del(context.Background(), key); err != nil {
+			logrus.Errorf("redis, err=%e", err)
+		}
+	}
+
+	return resp, err
+}
+
+// Dispatch processes the message and returns the body the transport should reply with, if any.
+// If the message was stored with StoreRaw the outcome is recorded on the stored delivery.
+func (d *Dispatcher) Dispatch(ctx context.Context, msg *Message) (resp string, err error) {
+	defer func() {
+		markProcessed(d.gCtx, msg, err)
+	}()
+
+	switch msg.Type {
+	case MessageTypeVerification:
+		return d.Verification(ctx, msg)
+	case MessageTypeNotification:
+		return "", d.Notification(ctx, msg)
+	case MessageTypeRevocation:
+		return "", d.Revocation(ctx, msg)
+	}
+
+	return "", ErrUnknownMessageType
+}
+
+func (d *Dispatcher) Verification(ctx context.Context, msg *Message) (string, error) {
+	if msg.Challenge == "" {
+		return "", ErrInvalidMessage
+	}
+
+	logrus.Infof("eventsub verification, type=%s broadcaster=%s", msg.Subscription.Type, msg.Subscription.Condition.BroadcasterUserID)
+
+	return msg.Challenge, nil
+}
+
+func (d *Dispatcher) Notification(ctx context.Context, msg *Message) error {
+	d.mtx.RLock()
+	handler, ok := d.handlers[msg.Subscription.Type]
+	d.mtx.RUnlock()
+
+	if !ok {
+		// we acknowledge events we cannot handle, otherwise twitch will keep retrying them.
+		logrus.Warnf("eventsub unhandled notification, type=%s id=%s", msg.Subscription.Type, msg.ID)
+		return nil
+	}
+
+	return handler(d.gCtx, ctx, msg)
+}
+
+func (d *Dispatcher) Revocation(ctx context.Context, msg *Message) error {
+	logrus.Warnf("eventsub revocation, type=%s broadcaster=%s status=%s", msg.Subscription.Type, msg.Subscription.Condition.BroadcasterUserID, msg.Subscription.Status)
+
+	switch msg.Subscription.Status {
+	case helix.EventSubStatusAuthorizationRevoked, helix.EventSubStatusUserRemoved:
+		return RevokeBroadcaster(d.gCtx, ctx, msg.Subscription.Condition.BroadcasterUserID)
+	}
+
+	// other revocations are recreated by the reconciler.
+	return nil
+}
@@ -0,0 +1,186 @@
+package eventsub
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/AdmiralBulldogTv/BulldogTax/src/configure"
+	"github.com/AdmiralBulldogTv/BulldogTax/src/global"
+	"github.com/AdmiralBulldogTv/BulldogTax/src/testutil"
+	"github.com/nicklaw5/helix"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+const notification = `{"subscription":{"id":"sub","type":"channel.channel_points_custom_reward_redemption.add","condition":{"broadcaster_user_id":"1"}},"event":{"id":"redemption"}}`
+
+func headers(msgType string) func(key string) string {
+	h := map[string]string{
+		"Twitch-Eventsub-Message-Id":        "message",
+		"Twitch-Eventsub-Message-Type":      msgType,
+		"Twitch-Eventsub-Message-Timestamp": "2022-03-01T10:00:00Z",
+	}
+
+	return func(key string) string {
+		return h[key]
+	}
+}
+
+func TestParseWebhook(t *testing.T) {
+	msg, err := ParseWebhook(headers(MessageTypeNotification), []byte(notification))
+	if err != nil {
+		t.Fatalf("ParseWebhook() err = %v", err)
+	}
+	if msg.ID != "message" || msg.Type != MessageTypeNotification || msg.Timestamp.Unix() != 1646128800 {
+		t.Errorf("ParseWebhook() = %+v", msg)
+	}
+	if msg.Subscription.ID != "sub" || msg.Subscription.Condition.BroadcasterUserID != "1" || string(msg.Event) != `{"id":"redemption"}` {
+		t.Errorf("ParseWebhook() body = %+v %s", msg.Subscription, msg.Event)
+	}
+
+	invalid := []struct {
+		name   string
+		header func(key string) string
+		body   string
+	}{
+		{"no timestamp", func(key string) string { return "" }, notification},
+		{"no id", func(key string) string {
+			if key == "Twitch-Eventsub-Message-Id" {
+				return ""
+			}
+			return headers(MessageTypeNotification)(key)
+		}, notification},
+		{"bad body", headers(MessageTypeNotification), "{"},
+	}
+	for _, tt := range invalid {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ParseWebhook(tt.header, []byte(tt.body)); err != ErrInvalidMessage {
+				t.Errorf("ParseWebhook() err = %v, want %v", err, ErrInvalidMessage)
+			}
+		})
+	}
+}
+
+func TestDispatch(t *testing.T) {
+	d := &Dispatcher{
+		gCtx:     global.New(context.Background(), &configure.Config{}),
+		handlers: map[string]NotificationHandler{},
+	}
+	handled := 0
+	d.Register(helix.EventSubTypeChannelPointsCustomRewardRedemptionAdd, func(gCtx global.Context, ctx context.Context, msg *Message) error {
+		handled++
+		return nil
+	})
+
+	tests := []struct {
+		name    string
+		msg     *Message
+		resp    string
+		err     error
+		handled int
+	}{
+		{"verification", &Message{Type: MessageTypeVerification, Challenge: "challenge"}, "challenge", nil, 0},
+		{"verification without challenge", &Message{Type: MessageTypeVerification}, "", ErrInvalidMessage, 0},
+		{"notification", &Message{Type: MessageTypeNotification, Subscription: helix.EventSubSubscription{Type: helix.EventSubTypeChannelPointsCustomRewardRedemptionAdd}}, "", nil, 1},
+		{"unhandled notification", &Message{Type: MessageTypeNotification, Subscription: helix.EventSubSubscription{Type: helix.EventSubTypeChannelFollow}}, "", nil, 0},
+		{"unknown", &Message{Type: "other"}, "", ErrUnknownMessageType, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handled = 0
+			resp, err := d.Dispatch(context.Background(), tt.msg)
+			if resp != tt.resp || err != tt.err {
+				t.Errorf("Dispatch() = %q, %v, want %q, %v", resp, err, tt.resp, tt.err)
+			}
+			if handled != tt.handled {
+				t.Errorf("handled %d times, want %d", handled, tt.handled)
+			}
+		})
+	}
+}
+
+func TestProcess(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+
+	stored := func() bson.D {
+		return mtest.CreateSuccessResponse(bson.E{Key: "value", Value: bson.D{
+			{Key: "_id", Value: primitive.NewObjectID()},
+			{Key: "message_id", Value: "message"},
+		}})
+	}
+
+	mt.Run("processed once", func(mt *mtest.T) {
+		gCtx, r := testutil.Context(mt, &configure.Config{})
+		d := &Dispatcher{gCtx: gCtx, handlers: map[string]NotificationHandler{}}
+		handled := 0
+		d.Register(helix.EventSubTypeChannelPointsCustomRewardRedemptionAdd, func(gCtx global.Context, ctx context.Context, msg *Message) error {
+			handled++
+			if msg.RawEventID.IsZero() {
+				mt.Error("the delivery was dispatched before it was stored")
+			}
+			return nil
+		})
+		mt.AddMockResponses(stored(), mtest.CreateSuccessResponse())
+
+		for i := 0; i < 2; i++ {
+			msg, err := ParseWebhook(headers(MessageTypeNotification), []byte(notification))
+			if err != nil {
+				mt.Fatal(err)
+			}
+			if _, err := d.Process(mtest.Background, msg, TransportWebhook, nil, []byte(notification)); err != nil {
+				mt.Fatalf("Process() err = %v", err)
+			}
+		}
+
+		if handled != 1 {
+			mt.Errorf("handled %d times, want a redelivery to be acknowledged only", handled)
+		}
+		if !r.Has("twitch:events:channel.channel_points_custom_reward_redemption.add:1:message") {
+			mt.Error("the delivery was not claimed")
+		}
+	})
+
+	mt.Run("failure releases the claim", func(mt *mtest.T) {
+		gCtx, r := testutil.Context(mt, &configure.Config{})
+		d := &Dispatcher{gCtx: gCtx, handlers: map[string]NotificationHandler{}}
+		handled := 0
+		d.Register(helix.EventSubTypeChannelPointsCustomRewardRedemptionAdd, func(gCtx global.Context, ctx context.Context, msg *Message) error {
+			handled++
+			return fmt.Errorf("failed")
+		})
+		mt.AddMockResponses(stored(), mtest.CreateSuccessResponse(), stored(), mtest.CreateSuccessResponse())
+
+		for i := 0; i < 2; i++ {
+			msg, err := ParseWebhook(headers(MessageTypeNotification), []byte(notification))
+			if err != nil {
+				mt.Fatal(err)
+			}
+			if _, err := d.Process(mtest.Background, msg, TransportWebhook, nil, []byte(notification)); err == nil {
+				mt.Fatal("Process() err = nil, want the error of the handler")
+			}
+		}
+
+		if handled != 2 {
+			mt.Errorf("handled %d times, want the redelivery to be processed again", handled)
+		}
+		if r.Has("twitch:events:channel.channel_points_custom_reward_redemption.add:1:message") {
+			mt.Error("the claim was not released")
+		}
+
+		// the error is recorded on the stored delivery.
+		var marked bool
+		for _, e := range mt.GetAllStartedEvents() {
+			if e.CommandName == "update" {
+				set := e.Command.Lookup("updates").Array().Index(0).Value().Document().Lookup("u", "$set").Document()
+				marked = set.Lookup("error").StringValue() == "failed"
+			}
+		}
+		if !marked {
+			mt.Error("the error was not recorded")
+		}
+	})
+}
@@ -0,0 +1,107 @@
+package eventsub
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/AdmiralBulldogTv/BulldogTax/src/global"
+	"github.com/AdmiralBulldogTv/BulldogTax/src/mongo"
+	"github.com/AdmiralBulldogTv/BulldogTax/src/structures"
+	"github.com/AdmiralBulldogTv/BulldogTax/src/utils"
+	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// StoreRaw persists the delivery as it was received and links it to the message.
+// Redeliveries of the same message id reuse the stored document.
+func StoreRaw(gCtx global.Context, ctx context.Context, msg *Message, transport string, headers map[string]string, body []byte) error {
+	raw := structures.RawEvent{}
+
+	res := gCtx.Inst().Mongo.Collection(mongo.CollectionNameRawEvents).FindOneAndUpdate(ctx, bson.M{
+		"message_id": msg.ID,
+	}, bson.M{
+		"$setOnInsert": structures.RawEvent{
+			MessageID:         msg.ID,
+			Transport:         transport,
+			MessageType:       msg.Type,
+			SubscriptionType:  msg.Subscription.Type,
+			BroadcasterUserID: msg.Subscription.Condition.BroadcasterUserID,
+			Headers:           headers,
+			Body:              string(body),
+			ReceivedAt:        time.Now(),
+		},
+	}, options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After))
+
+	err := res.Err()
+	if err == nil {
+		err = res.Decode(&raw)
+	}
+	if err != nil {
+		return err
+	}
+
+	msg.RawEventID = raw.ID
+
+	return nil
+}
+
+// ParseRaw rebuilds the Message of a stored delivery, so it can be dispatched again.
+func ParseRaw(raw structures.RawEvent) (*Message, error) {
+	var (
+		msg *Message
+		err error
+	)
+	if raw.Transport == TransportWebsocket {
+		msg, err = ParseWebsocket(utils.S2B(raw.Body))
+	} else {
+		msg, err = ParseWebhook(func(key string) string {
+			for k, v := range raw.Headers {
+				if strings.EqualFold(k, key) {
+					return v
+				}
+			}
+			return ""
+		}, utils.S2B(raw.Body))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	msg.RawEventID = raw.ID
+
+	return msg, nil
+}
+
+func markProcessed(gCtx global.Context, msg *Message, procErr error) {
+	if msg.RawEventID.IsZero() {
+		return
+	}
+
+	update := bson.M{
+		"$set": bson.M{
+			"processed_at": time.Now(),
+		},
+		"$unset": bson.M{
+			"error": "",
+		},
+	}
+	if procErr != nil {
+		update = bson.M{
+			"$set": bson.M{
+				"processed_at": time.Now(),
+				"error":        procErr.Error(),
+			},
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(gCtx, time.Second*10)
+	defer cancel()
+
+	if _, err := gCtx.Inst().Mongo.Collection(mongo.CollectionNameRawEvents).UpdateOne(ctx, bson.M{
+		"_id": msg.RawEventID,
+	}, update); err != nil {
+		logrus.Errorf("mongo, err=%v", err)
+	}
+}
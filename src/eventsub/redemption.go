@@ -0,0 +1,187 @@
+package eventsub
+
+import (
+	"context"
+	"time"
+
+	"github.com/AdmiralBulldogTv/BulldogTax/src/feed"
+	"github.com/AdmiralBulldogTv/BulldogTax/src/global"
+	"github.com/AdmiralBulldogTv/BulldogTax/src/ledger"
+	"github.com/AdmiralBulldogTv/BulldogTax/src/mongo"
+	"github.com/AdmiralBulldogTv/BulldogTax/src/redemptions"
+	"github.com/AdmiralBulldogTv/BulldogTax/src/structures"
+	"github.com/AdmiralBulldogTv/BulldogTax/src/taxes"
+	"github.com/nicklaw5/helix"
+	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func RedemptionAdd(gCtx global.Context, ctx context.Context, msg *Message) error {
+	event := helix.EventSubChannelPointsCustomRewardRedemptionEvent{}
+	if err := json.Unmarshal(msg.Event, &event); err != nil {
+		return err
+	}
+
+	ev := redeemEvent(event)
+
+	// an update can arrive before the add, in which case the status it stored wins.
+	update := bson.M{
+		"$setOnInsert": ev,
+	}
+	linkRawEvent(update, msg)
+
+	res, err := gCtx.Inst().Mongo.Collection(mongo.CollectionNameRedeemRewards).UpdateOne(ctx, bson.M{
+		"twitch_id": event.ID,
+	}, update, options.Update().SetUpsert(true))
+	if err != nil {
+		return err
+	}
+
+	if err := ledger.RecordRedemption(gCtx, ctx, event.BroadcasterUserID, ev); err != nil {
+		return err
+	}
+
+	publish(gCtx, ctx, res, ev)
+
+	// only new redemptions, replays and retries must not fulfill again. twitch is called outside of the
+	// delivery so it is acknowledged in time.
+	if res.UpsertedCount != 0 && gCtx.Config().Redemptions.AutoFulfill.Enabled {
+		go func() {
+			ctx, cancel := context.WithTimeout(gCtx, time.Second*30)
+			defer cancel()
+
+			redemptions.AutoFulfill(gCtx, ctx, event.BroadcasterUserID, event.ID)
+		}()
+	}
+
+	return nil
+}
+
+func RedemptionUpdate(gCtx global.Context, ctx context.Context, msg *Message) error {
+	event := helix.EventSubChannelPointsCustomRewardRedemptionEvent{}
+	if err := json.Unmarshal(msg.Event, &event); err != nil {
+		return err
+	}
+
+	ev := redeemEvent(event)
+	// mongo keeps milliseconds, a retried message has to find the time it stored.
+	changedAt := msg.Timestamp.Truncate(time.Millisecond)
+
+	// the add may never have arrived, the redemption is stored from the update then.
+	insert := ev
+	insert.StatusChangedAt = changedAt
+	insert.UpdatedAt = time.Now()
+	update := bson.M{
+		"$setOnInsert": insert,
+	}
+	linkRawEvent(update, msg)
+
+	res, err := gCtx.Inst().Mongo.Collection(mongo.CollectionNameRedeemRewards).UpdateOne(ctx, bson.M{
+		"twitch_id": event.ID,
+	}, update, options.Update().SetUpsert(true))
+	if err != nil {
+		return err
+	}
+
+	if res.UpsertedCount != 0 {
+		if err := ledger.RecordRedemption(gCtx, ctx, event.BroadcasterUserID, ev); err != nil {
+			return err
+		}
+		if ev.Status == structures.RedeemStatusCanceled {
+			if err := ledger.RecordRefund(gCtx, ctx, event.BroadcasterUserID, ev, changedAt); err != nil {
+				return err
+			}
+		}
+
+		publish(gCtx, ctx, res, ev)
+		return nil
+	}
+
+	// updates can arrive out of order, one older than the stored change is dropped.
+	prev := structures.RedeemEvent{}
+	err = gCtx.Inst().Mongo.Collection(mongo.CollectionNameRedeemRewards).FindOneAndUpdate(ctx, bson.M{
+		"twitch_id": event.ID,
+		"$or": bson.A{
+			bson.M{"status_changed_at": bson.M{"$exists": false}},
+			bson.M{"status_changed_at": bson.M{"$lte": changedAt}},
+		},
+	}, bson.M{
+		"$set": bson.M{
+			"status":            ev.Status,
+			"status_changed_at": changedAt,
+			"updated_at":        time.Now(),
+		},
+	}, options.FindOneAndUpdate().SetReturnDocument(options.Before)).Decode(&prev)
+	if err == mongo.ErrNoDocuments {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	// only the update that canceled it refunds, or its retry when the refund failed.
+	if ev.Status != structures.RedeemStatusCanceled {
+		return nil
+	}
+	if prev.Status == structures.RedeemStatusCanceled && !prev.StatusChangedAt.Equal(changedAt) {
+		return nil
+	}
+
+	if err := ledger.RecordRefund(gCtx, ctx, event.BroadcasterUserID, ev, changedAt); err != nil {
+		return err
+	}
+
+	publish(gCtx, ctx, res, ev)
+
+	return nil
+}
+
+func redeemEvent(event helix.EventSubChannelPointsCustomRewardRedemptionEvent) structures.RedeemEvent {
+	status := structures.RedeemStatus(event.Status)
+	if status == "" {
+		status = structures.RedeemStatusUnfulfilled
+	}
+
+	return structures.RedeemEvent{
+		TwitchID:          event.ID,
+		BroadcasterUserID: event.BroadcasterUserID,
+		BroadcasterLogin:  event.BroadcasterUserLogin,
+		RewardID:          event.Reward.ID,
+		RewardName:        event.Reward.Title,
+		UserID:            event.UserID,
+		UserName:          event.UserName,
+		Cost:              int32(event.Reward.Cost),
+		Status:            status,
+		RedeemedAt:        event.RedeemedAt.Time,
+	}
+}
+
+// publish sends a redemption the update stored to the live feed, along with where its user stands with the taxes
+// on it when that changed. Clients that miss it read it back when they resume, so failing to publish does not fail the delivery.
+func publish(gCtx global.Context, ctx context.Context, res *mongo.UpdateResult, ev structures.RedeemEvent) {
+	if id, ok := res.UpsertedID.(primitive.ObjectID); ok {
+		ev.ID = id
+		if err := feed.PublishRedemption(gCtx, ctx, ev); err != nil {
+			logrus.Errorf("redis, err=%v", err)
+		}
+	} else if ev.Status != structures.RedeemStatusCanceled {
+		return
+	}
+
+	if err := taxes.PublishCompliance(gCtx, ctx, ev.BroadcasterUserID, ev.RewardID, ev.UserID, ev.RedeemedAt); err != nil {
+		logrus.Errorf("taxes, err=%v", err)
+	}
+}
+
+// linkRawEvent adds the stored delivery of the message to the redemption, so it can be traced back.
+func linkRawEvent(update bson.M, msg *Message) {
+	if msg.RawEventID.IsZero() {
+		return
+	}
+
+	update["$addToSet"] = bson.M{
+		"raw_event_ids": msg.RawEventID,
+	}
+}
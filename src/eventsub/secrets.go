@@ -0,0 +1,143 @@
+package eventsub
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+
+	"github.com/AdmiralBulldogTv/BulldogTax/src/encryption"
+	"github.com/AdmiralBulldogTv/BulldogTax/src/global"
+	"github.com/AdmiralBulldogTv/BulldogTax/src/structures"
+	"github.com/AdmiralBulldogTv/BulldogTax/src/utils"
+)
+
+// Secrets are the configured webhook secrets in the order they are tried, they only verify subscriptions
+// created before every broadcaster got a secret of their own.
+func Secrets(gCtx global.Context) []string {
+	if len(gCtx.Config().Twitch.WebhookSecrets) != 0 {
+		return gCtx.Config().Twitch.WebhookSecrets
+	}
+
+	return []string{gCtx.Config().Twitch.WebhookSecret}
+}
+
+// SecretID identifies a configured secret on the subscriptions created with it, without storing the secret itself.
+func SecretID(secret string) string {
+	sum := sha256.Sum256(utils.S2B(secret))
+	return hex.EncodeToString(sum[:8])
+}
+
+// newSecret generates a webhook secret, returning it in plain text and encrypted for storage.
+func newSecret(gCtx global.Context) (string, string, error) {
+	key, err := encryption.Key(gCtx)
+	if err != nil {
+		return "", "", err
+	}
+
+	secret, err := utils.GenerateRandomString(32)
+	if err != nil {
+		return "", "", err
+	}
+
+	encrypted, err := encryption.Encrypt(key, secret)
+	if err != nil {
+		return "", "", err
+	}
+
+	return secret, encrypted, nil
+}
+
+// VerifySignature checks the Twitch-Eventsub-Message-Signature of a webhook delivery against secret.
+func VerifySignature(secret string, msgID string, timestamp string, body []byte, signature string) bool {
+	h := hmac.New(sha256.New, utils.S2B(secret))
+	_, _ = h.Write(utils.S2B(fmt.Sprintf("%s%s%s", msgID, timestamp, body)))
+
+	return hmac.Equal(utils.S2B(signature), utils.S2B(fmt.Sprintf("sha256=%s", hex.EncodeToString(h.Sum(nil)))))
+}
+
+// MatchWebhooks returns the webhooks of whs a delivery can belong to, the one of its subscription and for
+// verification requests the ones whose subscription is being created, twitch verifies those before we know their id.
+// A subscription replacing another one is verified with the next secret of the webhook.
+func MatchWebhooks(whs []structures.WebHook, msg *Message) []structures.WebHook {
+	matched := []structures.WebHook{}
+	for _, wh := range whs {
+		if wh.TwitchID != "" && wh.TwitchID == msg.Subscription.ID {
+			matched = append(matched, wh)
+			continue
+		}
+
+		if msg.Type != MessageTypeVerification || wh.Type != msg.Subscription.Type {
+			continue
+		}
+
+		if wh.NextSecret != "" {
+			matched = append(matched, structures.WebHook{
+				ID:       wh.ID,
+				TwitchID: msg.Subscription.ID,
+				UserID:   wh.UserID,
+				Type:     wh.Type,
+				Secret:   wh.NextSecret,
+			})
+		} else if wh.TwitchID == "" {
+			matched = append(matched, wh)
+		}
+	}
+
+	return matched
+}
+
+// VerifyWebhook checks a delivery against the secrets of the broadcaster's webhook documents.
+// Only documents created without a secret of their own fall back to the configured secrets,
+// starting with the one they were created with.
+func VerifyWebhook(gCtx global.Context, whs []structures.WebHook, msgID string, timestamp string, body []byte, signature string) (bool, error) {
+	var (
+		key      []byte
+		legacy   bool
+		secretID string
+	)
+	for _, wh := range whs {
+		if wh.Secret == "" {
+			if !legacy {
+				secretID = wh.SecretID
+			}
+			legacy = true
+			continue
+		}
+
+		if key == nil {
+			var err error
+			if key, err = encryption.Key(gCtx); err != nil {
+				return false, err
+			}
+		}
+
+		secret, err := encryption.Decrypt(key, wh.Secret)
+		if err != nil {
+			return false, err
+		}
+
+		if VerifySignature(secret, msgID, timestamp, body, signature) {
+			return true, nil
+		}
+	}
+
+	if !legacy {
+		return false, nil
+	}
+
+	secrets := Secrets(gCtx)
+	for _, secret := range secrets {
+		if SecretID(secret) == secretID && VerifySignature(secret, msgID, timestamp, body, signature) {
+			return true, nil
+		}
+	}
+
+	for _, secret := range secrets {
+		if SecretID(secret) != secretID && VerifySignature(secret, msgID, timestamp, body, signature) {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
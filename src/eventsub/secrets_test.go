@@ -0,0 +1,108 @@
+package eventsub
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"testing"
+
+	"github.com/AdmiralBulldogTv/BulldogTax/src/configure"
+	"github.com/AdmiralBulldogTv/BulldogTax/src/encryption"
+	"github.com/AdmiralBulldogTv/BulldogTax/src/global"
+	"github.com/AdmiralBulldogTv/BulldogTax/src/structures"
+)
+
+func sign(secret string, msgID string, timestamp string, body []byte) string {
+	h := hmac.New(sha256.New, []byte(secret))
+	h.Write([]byte(msgID + timestamp))
+	h.Write(body)
+
+	return "sha256=" + hex.EncodeToString(h.Sum(nil))
+}
+
+func TestVerifyWebhook(t *testing.T) {
+	key := make([]byte, 32)
+	for i := range key {
+		key[i] = byte(i)
+	}
+
+	encrypt := func(secret string) string {
+		encrypted, err := encryption.Encrypt(key, secret)
+		if err != nil {
+			t.Fatalf("Encrypt() err = %v", err)
+		}
+		return encrypted
+	}
+
+	const (
+		msgID     = "e76c6bd4-55c9-4987-8304-da1588d8988b"
+		timestamp = "2022-03-01T12:00:00.123456789Z"
+	)
+	body := []byte(`{"subscription":{},"event":{}}`)
+
+	own := structures.WebHook{Secret: encrypt("own-secret")}
+	other := structures.WebHook{Secret: encrypt("other-secret")}
+	legacyOld := structures.WebHook{SecretID: SecretID("old-secret")}
+	legacyNew := structures.WebHook{SecretID: SecretID("new-secret")}
+
+	tests := []struct {
+		name      string
+		secret    string
+		secrets   []string
+		whs       []structures.WebHook
+		signature string
+		want      bool
+	}{
+		{"own secret", "", nil, []structures.WebHook{own}, sign("own-secret", msgID, timestamp, body), true},
+		{"second own secret", "", nil, []structures.WebHook{other, own}, sign("own-secret", msgID, timestamp, body), true},
+		{"wrong signature", "", nil, []structures.WebHook{own}, sign("own-secret", msgID, timestamp, []byte("{}")), false},
+		{"own secret does not fall back", "", []string{"new-secret"}, []structures.WebHook{own}, sign("new-secret", msgID, timestamp, body), false},
+		{"legacy secret it was created with", "", []string{"new-secret", "old-secret"}, []structures.WebHook{legacyOld}, sign("old-secret", msgID, timestamp, body), true},
+		{"legacy secret it was not created with", "", []string{"new-secret", "old-secret"}, []structures.WebHook{legacyOld}, sign("new-secret", msgID, timestamp, body), true},
+		{"legacy single secret", "old-secret", nil, []structures.WebHook{legacyOld}, sign("old-secret", msgID, timestamp, body), true},
+		{"legacy unknown secret", "", []string{"new-secret", "old-secret"}, []structures.WebHook{legacyNew}, sign("other-secret", msgID, timestamp, body), false},
+		{"own and legacy", "", []string{"new-secret"}, []structures.WebHook{own, legacyNew}, sign("new-secret", msgID, timestamp, body), true},
+		{"no webhooks", "", []string{"new-secret"}, nil, sign("new-secret", msgID, timestamp, body), false},
+		{"no signature", "", []string{"new-secret"}, []structures.WebHook{own, legacyNew}, "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := &configure.Config{}
+			config.Encryption.Key = base64.StdEncoding.EncodeToString(key)
+			config.Twitch.WebhookSecret = tt.secret
+			config.Twitch.WebhookSecrets = tt.secrets
+			gCtx := global.New(context.Background(), config)
+
+			ok, err := VerifyWebhook(gCtx, tt.whs, msgID, timestamp, body, tt.signature)
+			if err != nil {
+				t.Fatalf("VerifyWebhook() err = %v", err)
+			}
+			if ok != tt.want {
+				t.Errorf("VerifyWebhook() = %v, want %v", ok, tt.want)
+			}
+		})
+	}
+}
+
+func TestVerifyWebhookInvalidSecret(t *testing.T) {
+	config := &configure.Config{}
+	config.Encryption.Key = base64.StdEncoding.EncodeToString(make([]byte, 32))
+	gCtx := global.New(context.Background(), config)
+
+	whs := []structures.WebHook{{Secret: "not encrypted"}}
+	if _, err := VerifyWebhook(gCtx, whs, "id", "timestamp", nil, "sha256=00"); err == nil {
+		t.Error("VerifyWebhook() err = nil")
+	}
+}
+
+func TestSecretID(t *testing.T) {
+	if SecretID("secret") == SecretID("other-secret") {
+		t.Error("SecretID() is the same for different secrets")
+	}
+	if id := SecretID("secret"); len(id) != 16 || id == "secret" {
+		t.Errorf("SecretID() = %q", id)
+	}
+}
@@ -0,0 +1,282 @@
+package eventsub
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/AdmiralBulldogTv/BulldogTax/src/global"
+	"github.com/AdmiralBulldogTv/BulldogTax/src/mongo"
+	"github.com/AdmiralBulldogTv/BulldogTax/src/structures"
+	"github.com/AdmiralBulldogTv/BulldogTax/src/twitch"
+	"github.com/nicklaw5/helix"
+	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var (
+	ErrNoWebsocketSession = fmt.Errorf("no eventsub websocket session")
+	// ErrSubscriptionExists is returned when twitch already holds a subscription of the type for the broadcaster.
+	ErrSubscriptionExists = fmt.Errorf("eventsub subscription already exists")
+)
+
+// SubscriptionTypes are the subscriptions created for every registered broadcaster.
+var SubscriptionTypes = []string{
+	helix.EventSubTypeChannelPointsCustomRewardRedemptionAdd,
+	helix.EventSubTypeChannelPointsCustomRewardRedemptionUpdate,
+}
+
+// Transport is the configured transport new subscriptions are created with.
+func Transport(gCtx global.Context) string {
+	if gCtx.Config().Twitch.EventSub.Transport == TransportWebsocket {
+		return TransportWebsocket
+	}
+
+	return TransportWebhook
+}
+
+// Unsubscribe removes every subscription we hold for the broadcaster, both on twitch and in mongo.
+func Unsubscribe(gCtx global.Context, ctx context.Context, api *helix.Client, userID string) error {
+	cur, err := gCtx.Inst().Mongo.Collection(mongo.CollectionNameWebhooks).Find(ctx, bson.M{
+		"user_id": userID,
+	})
+
+	whs := []structures.WebHook{}
+	if err == nil {
+		err = cur.All(ctx, &whs)
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, wh := range whs {
+		if _, err := api.RemoveEventSubSubscription(wh.TwitchID); err != nil {
+			if wh.Transport != TransportWebsocket {
+				return err
+			}
+			// websocket subscriptions need the broadcaster's token to be removed, they end with their session anyway.
+			logrus.Warnf("failed to remove websocket subscription, id=%s err=%v", wh.TwitchID, err)
+		}
+
+		if _, err := gCtx.Inst().Mongo.Collection(mongo.CollectionNameWebhooks).DeleteOne(ctx, bson.M{
+			"_id": wh.ID,
+		}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Subscribe creates a subscription of every type in SubscriptionTypes for the broadcaster, using the configured transport.
+// The websocket transport requires the broadcaster's user token, webhooks are created with the app token of api
+// and a secret of their own.
+func Subscribe(gCtx global.Context, ctx context.Context, api *helix.Client, userID string, userToken string) error {
+	transport := Transport(gCtx)
+
+	for _, subType := range SubscriptionTypes {
+		wh := structures.WebHook{
+			UserID:    userID,
+			Type:      subType,
+			Transport: transport,
+			CreatedAt: time.Now(),
+		}
+
+		var (
+			secret string
+			err    error
+		)
+		if transport == TransportWebhook {
+			secret, wh.Secret, err = newSecret(gCtx)
+			if err != nil {
+				return err
+			}
+		}
+
+		// the document has to exist before the subscription, twitch sends the verification request right away.
+		res, err := gCtx.Inst().Mongo.Collection(mongo.CollectionNameWebhooks).InsertOne(ctx, wh)
+		if err != nil {
+			return err
+		}
+		wh.ID, _ = res.InsertedID.(primitive.ObjectID)
+
+		sub, err := createSubscription(gCtx, ctx, api, transport, userToken, secret, subType, userID)
+		if err != nil {
+			if _, err := gCtx.Inst().Mongo.Collection(mongo.CollectionNameWebhooks).DeleteOne(ctx, bson.M{
+				"_id": wh.ID,
+			}); err != nil {
+				logrus.Errorf("mongo, err=%v", err)
+			}
+			return err
+		}
+
+		_, err = gCtx.Inst().Mongo.Collection(mongo.CollectionNameWebhooks).UpdateOne(ctx, bson.M{
+			"_id": wh.ID,
+		}, bson.M{
+			"$set": bson.M{
+				"twitch_id":  sub.ID,
+				"status":     sub.Status,
+				"checked_at": time.Now(),
+			},
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Resubscribe replaces the subscription of a webhook document with a new webhook subscription of the same type,
+// created with a new secret. The old subscription and its secret are kept until the new subscription exists,
+// unless twitch refuses to hold both at once, then the old subscription is removed first.
+func Resubscribe(gCtx global.Context, ctx context.Context, api *helix.Client, wh structures.WebHook) (structures.WebHook, error) {
+	// documents from before subscriptions had a type were all created for redemptions.
+	if wh.Type == "" {
+		wh.Type = helix.EventSubTypeChannelPointsCustomRewardRedemptionAdd
+	}
+
+	secret, encrypted, err := newSecret(gCtx)
+	if err != nil {
+		return wh, err
+	}
+
+	// the new secret has to be stored before the subscription, twitch sends the verification request right away.
+	if _, err := gCtx.Inst().Mongo.Collection(mongo.CollectionNameWebhooks).UpdateOne(ctx, bson.M{
+		"_id": wh.ID,
+	}, bson.M{
+		"$set": bson.M{
+			"next_secret": encrypted,
+		},
+	}); err != nil {
+		return wh, err
+	}
+
+	old := wh.TwitchID
+	sub, err := createSubscription(gCtx, ctx, api, TransportWebhook, "", secret, wh.Type, wh.UserID)
+	if err == ErrSubscriptionExists && old != "" {
+		if _, err := api.RemoveEventSubSubscription(old); err != nil {
+			return wh, err
+		}
+		old = ""
+
+		sub, err = createSubscription(gCtx, ctx, api, TransportWebhook, "", secret, wh.Type, wh.UserID)
+	}
+	if err != nil {
+		if _, err := gCtx.Inst().Mongo.Collection(mongo.CollectionNameWebhooks).UpdateOne(ctx, bson.M{
+			"_id": wh.ID,
+		}, bson.M{
+			"$unset": bson.M{
+				"next_secret": "",
+			},
+		}); err != nil {
+			logrus.Errorf("mongo, err=%v", err)
+		}
+		return wh, err
+	}
+
+	wh.TwitchID = sub.ID
+	wh.Transport = TransportWebhook
+	wh.Status = sub.Status
+	wh.Secret = encrypted
+	wh.SecretID = ""
+	wh.NextSecret = ""
+	wh.CheckedAt = time.Now()
+
+	if _, err := gCtx.Inst().Mongo.Collection(mongo.CollectionNameWebhooks).UpdateOne(ctx, bson.M{
+		"_id": wh.ID,
+	}, bson.M{
+		"$set": bson.M{
+			"twitch_id":  wh.TwitchID,
+			"type":       wh.Type,
+			"transport":  wh.Transport,
+			"status":     wh.Status,
+			"secret":     wh.Secret,
+			"secret_id":  wh.SecretID,
+			"checked_at": wh.CheckedAt,
+		},
+		"$unset": bson.M{
+			"next_secret": "",
+		},
+	}); err != nil {
+		return wh, err
+	}
+
+	if old != "" {
+		// the reconciler removes it as an orphan when this fails.
+		if _, err := api.RemoveEventSubSubscription(old); err != nil {
+			logrus.Warnf("failed to remove replaced subscription, id=%s err=%v", old, err)
+		}
+	}
+
+	return wh, nil
+}
+
+func createSubscription(gCtx global.Context, ctx context.Context, api *helix.Client, transport string, userToken string, secret string, subType string, userID string) (helix.EventSubSubscription, error) {
+	if transport == TransportWebsocket {
+		return createWebsocketSubscription(gCtx, ctx, userToken, subType, userID)
+	}
+
+	return createWebhookSubscription(gCtx, api, secret, subType, userID)
+}
+
+func createWebhookSubscription(gCtx global.Context, api *helix.Client, secret string, subType string, userID string) (helix.EventSubSubscription, error) {
+	resp, err := api.CreateEventSubSubscription(&helix.EventSubSubscription{
+		Type:    subType,
+		Version: "1",
+		Condition: helix.EventSubCondition{
+			BroadcasterUserID: userID,
+		},
+		Transport: helix.EventSubTransport{
+			Method:   TransportWebhook,
+			Callback: fmt.Sprintf("%s/webhook/%s", gCtx.Config().Frontend.WebsiteURL, userID),
+			Secret:   secret,
+		},
+	})
+	if err == nil && resp.ErrorStatus == http.StatusConflict {
+		return helix.EventSubSubscription{}, ErrSubscriptionExists
+	}
+	if err != nil || resp.Error != "" || len(resp.Data.EventSubSubscriptions) == 0 {
+		if err == nil {
+			err = fmt.Errorf("%s %s %d", resp.Error, resp.ErrorMessage, resp.ErrorStatus)
+		}
+		return helix.EventSubSubscription{}, err
+	}
+
+	return resp.Data.EventSubSubscriptions[0], nil
+}
+
+// the helix client cannot create websocket subscriptions, it has no session id on its transport.
+func createWebsocketSubscription(gCtx global.Context, ctx context.Context, userToken string, subType string, userID string) (helix.EventSubSubscription, error) {
+	sessionID, err := gCtx.Inst().Redis.Get(ctx, websocketSessionKey)
+	if err != nil {
+		return helix.EventSubSubscription{}, ErrNoWebsocketSession
+	}
+
+	resp := helix.ManyEventSubSubscriptions{}
+	if err := twitch.Request(gCtx, ctx, twitch.RequestOptions{
+		Method: "POST",
+		Path:   "/eventsub/subscriptions",
+		Token:  userToken,
+		Body: map[string]interface{}{
+			"type":    subType,
+			"version": "1",
+			"condition": map[string]interface{}{
+				"broadcaster_user_id": userID,
+			},
+			"transport": map[string]interface{}{
+				"method":     TransportWebsocket,
+				"session_id": sessionID,
+			},
+		},
+	}, &resp); err != nil {
+		return helix.EventSubSubscription{}, err
+	}
+	if len(resp.EventSubSubscriptions) == 0 {
+		return helix.EventSubSubscription{}, fmt.Errorf("no subscription in response")
+	}
+
+	return resp.EventSubSubscriptions[0], nil
+}
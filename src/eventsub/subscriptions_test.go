@@ -0,0 +1,131 @@
+package eventsub
+
+import (
+	"encoding/base64"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/AdmiralBulldogTv/BulldogTax/src/configure"
+	"github.com/AdmiralBulldogTv/BulldogTax/src/structures"
+	"github.com/AdmiralBulldogTv/BulldogTax/src/testutil"
+	"github.com/nicklaw5/helix"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+type roundTripper func(req *http.Request) (*http.Response, error)
+
+func (f roundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+type reply struct {
+	status int
+	body   string
+}
+
+// twitchResponds answers the requests helix makes with replies in order, and records their methods.
+func twitchResponds(t *testing.T, replies ...reply) *[]string {
+	requests := &[]string{}
+	prev := http.DefaultTransport
+	http.DefaultTransport = roundTripper(func(req *http.Request) (*http.Response, error) {
+		r := reply{status: 500, body: "{}"}
+		if len(*requests) < len(replies) {
+			r = replies[len(*requests)]
+		}
+		*requests = append(*requests, req.Method)
+
+		return &http.Response{
+			StatusCode: r.status,
+			Header:     http.Header{"Content-Type": []string{"application/json"}},
+			Body:       ioutil.NopCloser(strings.NewReader(r.body)),
+			Request:    req,
+		}, nil
+	})
+	t.Cleanup(func() {
+		http.DefaultTransport = prev
+	})
+
+	return requests
+}
+
+func TestResubscribe(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+
+	created := reply{202, `{"data":[{"id":"new-sub","status":"webhook_callback_verification_pending","type":"channel.channel_points_custom_reward_redemption.add"}],"total":1}`}
+	removed := reply{204, ""}
+	conflict := reply{409, `{"error":"Conflict","status":409,"message":"subscription already exists"}`}
+	failed := reply{500, `{"error":"Internal Server Error","status":500,"message":""}`}
+
+	tests := []struct {
+		name     string
+		replies  []reply
+		requests []string
+		err      bool
+	}{
+		{"created before the old one is removed", []reply{created, removed}, []string{"POST", "DELETE"}, false},
+		{"both cannot be held at once", []reply{conflict, removed, created}, []string{"POST", "DELETE", "POST"}, false},
+		{"old one is kept when creating fails", []reply{failed}, []string{"POST"}, true},
+	}
+
+	for _, tt := range tests {
+		mt.Run(tt.name, func(mt *mtest.T) {
+			requests := twitchResponds(mt.T, tt.replies...)
+
+			config := &configure.Config{}
+			config.Encryption.Key = base64.StdEncoding.EncodeToString(make([]byte, 32))
+			config.Frontend.WebsiteURL = "https://example.com"
+			gCtx, _ := testutil.Context(mt, config)
+			mt.AddMockResponses(mtest.CreateSuccessResponse(), mtest.CreateSuccessResponse())
+
+			api, err := helix.NewClient(&helix.Options{
+				ClientID:       "client",
+				AppAccessToken: "token",
+			})
+			if err != nil {
+				mt.Fatal(err)
+			}
+
+			// a document from before subscriptions had a type.
+			wh := structures.WebHook{ID: primitive.NewObjectID(), TwitchID: "old-sub", UserID: "1", Secret: "old-secret"}
+			nwh, err := Resubscribe(gCtx, mtest.Background, api, wh)
+			if tt.err != (err != nil) {
+				mt.Fatalf("Resubscribe() err = %v", err)
+			}
+			if strings.Join(*requests, ",") != strings.Join(tt.requests, ",") {
+				mt.Errorf("requests = %v, want %v", *requests, tt.requests)
+			}
+
+			first := mt.GetStartedEvent()
+			set := first.Command.Lookup("updates").Array().Index(0).Value().Document().Lookup("u", "$set").Document()
+			if _, err := set.LookupErr("secret"); err == nil {
+				mt.Error("the secret was replaced before the subscription was created")
+			}
+			if next := set.Lookup("next_secret").StringValue(); next == "" {
+				mt.Error("the next secret was not stored before the subscription was created")
+			}
+
+			last := mt.GetStartedEvent().Command.Lookup("updates").Array().Index(0).Value().Document().Lookup("u").Document()
+			if tt.err {
+				if _, err := last.LookupErr("$set"); err == nil {
+					mt.Error("the webhook was changed after creating the subscription failed")
+				}
+				return
+			}
+
+			set = last.Lookup("$set").Document()
+			if id := set.Lookup("twitch_id").StringValue(); id != "new-sub" || nwh.TwitchID != "new-sub" {
+				mt.Errorf("twitch_id = %q, want the new subscription", id)
+			}
+			if typ := set.Lookup("type").StringValue(); typ != helix.EventSubTypeChannelPointsCustomRewardRedemptionAdd {
+				mt.Errorf("type = %q, want the redemption type to be backfilled", typ)
+			}
+			if secret := set.Lookup("secret").StringValue(); secret == "old-secret" || secret == "" {
+				mt.Error("the new secret was not stored")
+			}
+		})
+	}
+}
@@ -0,0 +1,250 @@
+package eventsub
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/AdmiralBulldogTv/BulldogTax/src/global"
+	"github.com/fasthttp/websocket"
+	jsoniter "github.com/json-iterator/go"
+	"github.com/nicklaw5/helix"
+	"github.com/sirupsen/logrus"
+)
+
+// DefaultWebsocketURL is the EventSub websocket endpoint of twitch.
+const DefaultWebsocketURL = "wss://eventsub.wss.twitch.tv/ws"
+
+// websocketSessionKey holds the id of the active session, so every instance can create subscriptions on it.
+const websocketSessionKey = "twitch:eventsub:session"
+
+const (
+	websocketMessageWelcome      = "session_welcome"
+	websocketMessageKeepalive    = "session_keepalive"
+	websocketMessageReconnect    = "session_reconnect"
+	websocketMessageNotification = "notification"
+	websocketMessageRevocation   = "revocation"
+)
+
+type websocketSession struct {
+	ID                      string `json:"id"`
+	Status                  string `json:"status"`
+	KeepaliveTimeoutSeconds int    `json:"keepalive_timeout_seconds"`
+	ReconnectURL            string `json:"reconnect_url"`
+}
+
+type websocketMessage struct {
+	Metadata struct {
+		MessageID        string    `json:"message_id"`
+		MessageType      string    `json:"message_type"`
+		MessageTimestamp time.Time `json:"message_timestamp"`
+		SubscriptionType string    `json:"subscription_type"`
+	} `json:"metadata"`
+	Payload struct {
+		Session      *websocketSession          `json:"session"`
+		Subscription helix.EventSubSubscription `json:"subscription"`
+		Event        jsoniter.RawMessage        `json:"event"`
+	} `json:"payload"`
+}
+
+// ParseWebsocket builds a Message from a notification or revocation frame of the websocket transport.
+func ParseWebsocket(body []byte) (*Message, error) {
+	wm := websocketMessage{}
+	if err := json.Unmarshal(body, &wm); err != nil {
+		return nil, ErrInvalidMessage
+	}
+
+	return websocketToMessage(wm)
+}
+
+func websocketToMessage(wm websocketMessage) (*Message, error) {
+	msg := &Message{
+		ID:           wm.Metadata.MessageID,
+		Timestamp:    wm.Metadata.MessageTimestamp,
+		Subscription: wm.Payload.Subscription,
+		Event:        wm.Payload.Event,
+	}
+
+	switch wm.Metadata.MessageType {
+	case websocketMessageNotification:
+		msg.Type = MessageTypeNotification
+	case websocketMessageRevocation:
+		msg.Type = MessageTypeRevocation
+	default:
+		return nil, ErrUnknownMessageType
+	}
+
+	if msg.ID == "" {
+		return nil, ErrInvalidMessage
+	}
+
+	return msg, nil
+}
+
+type websocketClient struct {
+	gCtx       global.Context
+	dispatcher *Dispatcher
+	sessionID  string
+}
+
+// Websocket receives events over the EventSub websocket transport and feeds them into the dispatcher.
+// Only a single instance should run it, the session it holds is shared with the others through redis.
+func Websocket(gCtx global.Context, dispatcher *Dispatcher) <-chan struct{} {
+	client := &websocketClient{
+		gCtx:       gCtx,
+		dispatcher: dispatcher,
+	}
+
+	url := gCtx.Config().Twitch.EventSub.WebsocketURL
+	if url == "" {
+		url = DefaultWebsocketURL
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+
+		backoff := time.Second
+		for {
+			err := client.run(url)
+			if gCtx.Err() != nil {
+				return
+			}
+
+			logrus.Errorf("eventsub websocket, err=%v", err)
+
+			select {
+			case <-gCtx.Done():
+				return
+			case <-time.After(backoff):
+			}
+
+			if backoff < time.Minute {
+				backoff *= 2
+			}
+		}
+	}()
+
+	return done
+}
+
+// connect dials url and waits for the welcome of the session.
+func (w *websocketClient) connect(url string) (*websocket.Conn, *websocketSession, error) {
+	ctx, cancel := context.WithTimeout(w.gCtx, time.Second*15)
+	defer cancel()
+
+	conn, _, err := websocket.DefaultDialer.DialContext(ctx, url, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	_ = conn.SetReadDeadline(time.Now().Add(time.Second * 15))
+
+	wm := websocketMessage{}
+	if err := conn.ReadJSON(&wm); err != nil {
+		_ = conn.Close()
+		return nil, nil, err
+	}
+
+	if wm.Metadata.MessageType != websocketMessageWelcome || wm.Payload.Session == nil {
+		_ = conn.Close()
+		return nil, nil, fmt.Errorf("expected welcome, got %s", wm.Metadata.MessageType)
+	}
+
+	return conn, wm.Payload.Session, nil
+}
+
+// run holds a session until it fails, following reconnect requests from twitch along the way.
+func (w *websocketClient) run(url string) error {
+	conn, session, err := w.connect(url)
+	if err != nil {
+		return err
+	}
+
+	if w.sessionID != "" && w.sessionID != session.ID {
+		logrus.Warn("eventsub websocket, new session, subscriptions of the previous session are gone and broadcasters need to login again")
+	}
+
+	w.sessionID = session.ID
+	if err := w.gCtx.Inst().Redis.Set(w.gCtx, websocketSessionKey, session.ID); err != nil {
+		_ = conn.Close()
+		return err
+	}
+
+	logrus.Infof("eventsub websocket, session=%s", session.ID)
+
+	// closing the connection on shutdown unblocks the read below.
+	mtx := sync.Mutex{}
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		select {
+		case <-w.gCtx.Done():
+		case <-stop:
+			return
+		}
+		mtx.Lock()
+		_ = conn.Close()
+		mtx.Unlock()
+	}()
+
+	keepalive := time.Duration(session.KeepaliveTimeoutSeconds) * time.Second
+	for {
+		_ = conn.SetReadDeadline(time.Now().Add(keepalive + time.Second*10))
+
+		_, body, err := conn.ReadMessage()
+		if err != nil {
+			_ = conn.Close()
+			return err
+		}
+
+		wm := websocketMessage{}
+		if err := json.Unmarshal(body, &wm); err != nil {
+			logrus.Errorf("eventsub websocket, invalid message err=%v", err)
+			continue
+		}
+
+		switch wm.Metadata.MessageType {
+		case websocketMessageKeepalive:
+		case websocketMessageReconnect:
+			if wm.Payload.Session == nil {
+				continue
+			}
+
+			// the new connection keeps our session and subscriptions, the old one can be closed once it is welcomed.
+			newConn, newSession, err := w.connect(wm.Payload.Session.ReconnectURL)
+			if err != nil {
+				_ = conn.Close()
+				return err
+			}
+			_ = conn.Close()
+
+			mtx.Lock()
+			conn = newConn
+			mtx.Unlock()
+			keepalive = time.Duration(newSession.KeepaliveTimeoutSeconds) * time.Second
+		case websocketMessageNotification, websocketMessageRevocation:
+			msg, err := websocketToMessage(wm)
+			if err != nil {
+				logrus.Errorf("eventsub websocket, invalid message err=%v", err)
+				continue
+			}
+
+			headers := map[string]string{
+				"Twitch-Eventsub-Message-Id":        wm.Metadata.MessageID,
+				"Twitch-Eventsub-Message-Type":      wm.Metadata.MessageType,
+				"Twitch-Eventsub-Message-Timestamp": wm.Metadata.MessageTimestamp.Format(time.RFC3339Nano),
+				"Twitch-Eventsub-Subscription-Type": wm.Metadata.SubscriptionType,
+			}
+
+			ctx, cancel := context.WithTimeout(w.gCtx, time.Second*10)
+			if _, err := w.dispatcher.Process(ctx, msg, TransportWebsocket, headers, body); err != nil {
+				logrus.Errorf("eventsub, type=%s err=%v", msg.Subscription.Type, err)
+			}
+			cancel()
+		default:
+			logrus.Warnf("eventsub websocket, unknown message type=%s", wm.Metadata.MessageType)
+		}
+	}
+}
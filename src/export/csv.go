@@ -0,0 +1,37 @@
+package export
+
+import (
+	"encoding/csv"
+	"io"
+)
+
+type csvWriter struct {
+	w   *csv.Writer
+	row []string
+}
+
+func newCSVWriter(w io.Writer, columns []string) (Writer, error) {
+	cw := &csvWriter{
+		w:   csv.NewWriter(w),
+		row: make([]string, len(columns)),
+	}
+
+	if err := cw.w.Write(columns); err != nil {
+		return nil, err
+	}
+
+	return cw, nil
+}
+
+func (cw *csvWriter) Row(values ...interface{}) error {
+	for i, v := range values {
+		cw.row[i] = cellText(v)
+	}
+
+	return cw.w.Write(cw.row)
+}
+
+func (cw *csvWriter) Close() error {
+	cw.w.Flush()
+	return cw.w.Error()
+}
@@ -0,0 +1,111 @@
+package export
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	FormatJSON   = "json"
+	FormatCSV    = "csv"
+	FormatNDJSON = "ndjson"
+	FormatXLSX   = "xlsx"
+)
+
+var ErrUnknownFormat = fmt.Errorf("format must be json, csv, ndjson or xlsx")
+
+var contentTypes = map[string]string{
+	FormatJSON:   "application/json",
+	FormatCSV:    "text/csv",
+	FormatNDJSON: "application/x-ndjson",
+	FormatXLSX:   "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+}
+
+// Writer writes rows of a table, values are strings, integers, bools or times.
+type Writer interface {
+	Row(values ...interface{}) error
+	// Close finishes the file, nothing is written to the underlying writer after it.
+	Close() error
+}
+
+// Negotiate picks the format from the format parameter, or else the accept header, json when neither asks for one.
+func Negotiate(format string, accept string) (string, error) {
+	if format != "" {
+		if _, ok := contentTypes[format]; !ok {
+			return "", ErrUnknownFormat
+		}
+		return format, nil
+	}
+
+	for _, part := range strings.Split(accept, ",") {
+		mime := strings.TrimSpace(strings.SplitN(part, ";", 2)[0])
+		for f, ct := range contentTypes {
+			if mime == ct {
+				return f, nil
+			}
+		}
+	}
+
+	return FormatJSON, nil
+}
+
+// ContentType is the mime type of the format.
+func ContentType(format string) string {
+	return contentTypes[format]
+}
+
+// NewWriter starts a file of the format on w with a header of columns, json is not a file format.
+func NewWriter(format string, w io.Writer, columns []string) (Writer, error) {
+	switch format {
+	case FormatCSV:
+		return newCSVWriter(w, columns)
+	case FormatNDJSON:
+		return newNDJSONWriter(w, columns), nil
+	case FormatXLSX:
+		return newXLSXWriter(w, columns)
+	}
+
+	return nil, ErrUnknownFormat
+}
+
+// text formats a value for formats that only have strings.
+func text(v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case int:
+		return strconv.Itoa(v)
+	case int32:
+		return strconv.FormatInt(int64(v), 10)
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case bool:
+		return strconv.FormatBool(v)
+	case time.Time:
+		if v.IsZero() {
+			return ""
+		}
+		return v.Format(time.RFC3339)
+	case nil:
+		return ""
+	}
+
+	return fmt.Sprint(v)
+}
+
+// cellText is text for a spreadsheet cell, strings a spreadsheet would run as a formula are prefixed with a quote.
+func cellText(v interface{}) string {
+	s, ok := v.(string)
+	if !ok {
+		return text(v)
+	}
+
+	if s != "" && strings.ContainsRune("=+-@\t\r", rune(s[0])) {
+		return "'" + s
+	}
+
+	return s
+}
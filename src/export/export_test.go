@@ -0,0 +1,91 @@
+package export
+
+import (
+	"archive/zip"
+	"bytes"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestNegotiate(t *testing.T) {
+	tests := []struct {
+		name   string
+		format string
+		accept string
+		want   string
+		err    error
+	}{
+		{"default", "", "", FormatJSON, nil},
+		{"anything", "", "*/*", FormatJSON, nil},
+		{"format", "csv", "", FormatCSV, nil},
+		{"format over accept", "ndjson", "text/csv", FormatNDJSON, nil},
+		{"unknown format", "xml", "text/csv", "", ErrUnknownFormat},
+		{"accept", "", "text/csv", FormatCSV, nil},
+		{"accept with parameters", "", "application/x-ndjson; charset=utf-8", FormatNDJSON, nil},
+		{"first known accept", "", "text/html, application/vnd.openxmlformats-officedocument.spreadsheetml.sheet;q=0.9, text/csv", FormatXLSX, nil},
+		{"unknown accept", "", "text/html", FormatJSON, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Negotiate(tt.format, tt.accept)
+			if err != tt.err {
+				t.Fatalf("Negotiate() err = %v, want %v", err, tt.err)
+			}
+			if got != tt.want {
+				t.Errorf("Negotiate() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFormulas(t *testing.T) {
+	values := []interface{}{"=1+1", "+1", "-1", "@SUM(A1)", "\tx", "\rx", "user", int32(-5)}
+
+	buf := &bytes.Buffer{}
+	w, err := NewWriter(FormatCSV, buf, []string{"a", "b", "c", "d", "e", "f", "g", "h"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Row(values...); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	want := "a,b,c,d,e,f,g,h\n'=1+1,'+1,'-1,'@SUM(A1),'\tx,\"'\rx\",user,-5\n"
+	if buf.String() != want {
+		t.Errorf("csv = %q, want %q", buf.String(), want)
+	}
+
+	buf.Reset()
+	if w, err = NewWriter(FormatXLSX, buf, []string{"a", "b"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Row("=1+1", int32(-5)); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range zr.File {
+		if f.Name != "xl/worksheets/sheet1.xml" {
+			continue
+		}
+		r, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		sheet, _ := ioutil.ReadAll(r)
+		if !strings.Contains(string(sheet), `<t xml:space="preserve">&#39;=1+1</t>`) || !strings.Contains(string(sheet), "<v>-5</v>") {
+			t.Errorf("sheet = %s, want the formula quoted and the number kept", sheet)
+		}
+	}
+}
@@ -0,0 +1,36 @@
+package export
+
+import (
+	"io"
+
+	jsoniter "github.com/json-iterator/go"
+)
+
+var json = jsoniter.ConfigCompatibleWithStandardLibrary
+
+type ndjsonWriter struct {
+	enc     *jsoniter.Encoder
+	columns []string
+	row     map[string]interface{}
+}
+
+func newNDJSONWriter(w io.Writer, columns []string) Writer {
+	return &ndjsonWriter{
+		enc:     json.NewEncoder(w),
+		columns: columns,
+		row:     make(map[string]interface{}, len(columns)),
+	}
+}
+
+// Row writes the values as one object keyed on the columns, the encoder ends it with a newline.
+func (nw *ndjsonWriter) Row(values ...interface{}) error {
+	for i, v := range values {
+		nw.row[nw.columns[i]] = v
+	}
+
+	return nw.enc.Encode(nw.row)
+}
+
+func (nw *ndjsonWriter) Close() error {
+	return nil
+}
@@ -0,0 +1,179 @@
+package feed
+
+import (
+	"context"
+	"time"
+
+	"github.com/AdmiralBulldogTv/BulldogTax/src/global"
+	"github.com/AdmiralBulldogTv/BulldogTax/src/mongo"
+	"github.com/AdmiralBulldogTv/BulldogTax/src/structures"
+	jsoniter "github.com/json-iterator/go"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var json = jsoniter.ConfigCompatibleWithStandardLibrary
+
+// The redis channels changes are published on, every instance relays them to its clients.
+const (
+	// ChannelRedemptions carries an Event for every new redemption.
+	ChannelRedemptions = "feed:redemptions"
+	// ChannelCompliance carries a Compliance when something counting toward a tax changed.
+	ChannelCompliance = "feed:compliance"
+	// ChannelBalances carries the structures.Balance a ledger entry changed.
+	ChannelBalances = "feed:balances"
+)
+
+// Event is a stored redemption as clients of the feed see it, the id orders the feed.
+type Event struct {
+	ID                primitive.ObjectID      `json:"id"`
+	TwitchID          string                  `json:"twitch_id"`
+	BroadcasterUserID string                  `json:"broadcaster_user_id"`
+	BroadcasterLogin  string                  `json:"broadcaster_login"`
+	RewardID          string                  `json:"reward_id"`
+	RewardName        string                  `json:"reward_name"`
+	UserID            string                  `json:"user_id"`
+	UserName          string                  `json:"user_name"`
+	Cost              int32                   `json:"cost"`
+	Status            structures.RedeemStatus `json:"status"`
+	RedeemedAt        time.Time               `json:"redeemed_at"`
+}
+
+func NewEvent(ev structures.RedeemEvent) Event {
+	return Event{
+		ID:                ev.ID,
+		TwitchID:          ev.TwitchID,
+		BroadcasterUserID: ev.BroadcasterUserID,
+		BroadcasterLogin:  ev.BroadcasterLogin,
+		RewardID:          ev.RewardID,
+		RewardName:        ev.RewardName,
+		UserID:            ev.UserID,
+		UserName:          ev.UserName,
+		Cost:              ev.Cost,
+		Status:            ev.Status,
+		RedeemedAt:        ev.RedeemedAt,
+	}
+}
+
+// Compliance is where a user stands with a tax rule in a period, after a change to it.
+type Compliance struct {
+	RuleID            primitive.ObjectID `json:"rule_id"`
+	BroadcasterUserID string             `json:"broadcaster_user_id"`
+	PeriodStart       time.Time          `json:"period_start"`
+	PeriodEnd         time.Time          `json:"period_end"`
+	UserID            string             `json:"user_id"`
+	Count             int32              `json:"count"`
+	Amount            int32              `json:"amount"`
+	Exempt            bool               `json:"exempt"`
+	Compliant         bool               `json:"compliant"`
+}
+
+// ReplayOverlap is how long after a resume the live copies of the redemptions it read back can still arrive.
+const ReplayOverlap = time.Minute
+
+// Replayed holds the ids of the redemptions a resume read back from mongo. Their live copies arrive in no particular
+// order, so they are skipped by id, once each, rather than by comparing ids.
+type Replayed map[primitive.ObjectID]struct{}
+
+func (r Replayed) Add(id primitive.ObjectID) {
+	r[id] = struct{}{}
+}
+
+// Skip reports whether the live event was sent on the resume already.
+func (r Replayed) Skip(e Event) bool {
+	if _, ok := r[e.ID]; ok {
+		delete(r, e.ID)
+		return true
+	}
+
+	return false
+}
+
+// Filter scopes the feed to broadcasters, rewards or both, an empty list matches everything.
+type Filter struct {
+	BroadcasterIDs []string
+	RewardIDs      []string
+}
+
+func (f Filter) Match(e Event) bool {
+	return contains(f.BroadcasterIDs, e.BroadcasterUserID) && contains(f.RewardIDs, e.RewardID)
+}
+
+func (f Filter) query() bson.M {
+	query := bson.M{}
+	if len(f.BroadcasterIDs) != 0 {
+		query["broadcaster_user_id"] = bson.M{"$in": f.BroadcasterIDs}
+	}
+	if len(f.RewardIDs) != 0 {
+		query["reward_id"] = bson.M{"$in": f.RewardIDs}
+	}
+
+	return query
+}
+
+func contains(values []string, v string) bool {
+	if len(values) == 0 {
+		return true
+	}
+	for _, value := range values {
+		if value == v {
+			return true
+		}
+	}
+
+	return false
+}
+
+// PublishRedemption sends the stored redemption to the clients of every instance.
+func PublishRedemption(gCtx global.Context, ctx context.Context, ev structures.RedeemEvent) error {
+	return publish(gCtx, ctx, ChannelRedemptions, NewEvent(ev))
+}
+
+func PublishCompliance(gCtx global.Context, ctx context.Context, c Compliance) error {
+	return publish(gCtx, ctx, ChannelCompliance, c)
+}
+
+func PublishBalance(gCtx global.Context, ctx context.Context, balance structures.Balance) error {
+	return publish(gCtx, ctx, ChannelBalances, balance)
+}
+
+func publish(gCtx global.Context, ctx context.Context, channel string, v interface{}) error {
+	data, err := json.MarshalToString(v)
+	if err != nil {
+		return err
+	}
+
+	return gCtx.Inst().Redis.Publish(ctx, channel, data)
+}
+
+// Parse reads a message as it was published on a channel.
+func Parse(payload string, v interface{}) error {
+	return json.UnmarshalFromString(payload, v)
+}
+
+// Since calls fn with the stored redemptions matching the filter that come after the id, in the order of the feed.
+// Clients resume with it, redemptions stored while they were away are read back from mongo.
+func Since(gCtx global.Context, ctx context.Context, filter Filter, after primitive.ObjectID, fn func(e Event) error) error {
+	query := filter.query()
+	query["_id"] = bson.M{"$gt": after}
+
+	cur, err := gCtx.Inst().Mongo.Collection(mongo.CollectionNameRedeemRewards).Find(ctx, query, options.Find().
+		SetSort(bson.M{"_id": 1}))
+	if err != nil {
+		return err
+	}
+	defer cur.Close(ctx)
+
+	for cur.Next(ctx) {
+		ev := structures.RedeemEvent{}
+		if err := cur.Decode(&ev); err != nil {
+			return err
+		}
+		if err := fn(NewEvent(ev)); err != nil {
+			return err
+		}
+	}
+
+	return cur.Err()
+}
@@ -3,6 +3,7 @@ package global
 import "github.com/AdmiralBulldogTv/BulldogTax/src/instance"
 
 type Instances struct {
-	Redis instance.Redis
-	Mongo instance.Mongo
+	Redis  instance.Redis
+	Mongo  instance.Mongo
+	Tokens instance.Tokens
 }
@@ -0,0 +1,23 @@
+package instance
+
+import (
+	"context"
+
+	"github.com/nicklaw5/helix"
+)
+
+// Tokens stores the user tokens of broadcasters, so we can act on their behalf.
+type Tokens interface {
+	// Save stores the credentials of a broadcaster, replacing the previous ones.
+	Save(ctx context.Context, userID string, creds helix.AccessCredentials) error
+	// AccessToken returns a valid access token of the broadcaster, refreshing it when it is about to expire.
+	AccessToken(ctx context.Context, userID string) (string, error)
+	// Scopes returns the scopes the broadcaster granted us.
+	Scopes(ctx context.Context, userID string) ([]string, error)
+	// Refresh exchanges the refresh token of the broadcaster for a new access token.
+	Refresh(ctx context.Context, userID string) error
+	// RefreshExpiring refreshes every token that expires before the configured margin.
+	RefreshExpiring(ctx context.Context) error
+	// Delete drops the tokens of the broadcaster.
+	Delete(ctx context.Context, userID string) error
+}
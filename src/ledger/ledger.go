@@ -0,0 +1,167 @@
+package ledger
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/AdmiralBulldogTv/BulldogTax/src/feed"
+	"github.com/AdmiralBulldogTv/BulldogTax/src/global"
+	"github.com/AdmiralBulldogTv/BulldogTax/src/mongo"
+	"github.com/AdmiralBulldogTv/BulldogTax/src/structures"
+	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// balanceRecentKeys is how many keys of entries a balance keeps, a failed entry is retried well within them.
+const balanceRecentKeys = 100
+
+// Record appends the entry to the ledger and adds it to the balance of the user.
+// Entries are keyed on what they were made for, recording one twice does nothing.
+// The two writes are not atomic, an entry stays pending until it was added to the balance,
+// and recording it again finishes what the first attempt did not.
+func Record(gCtx global.Context, ctx context.Context, entry structures.LedgerEntry) error {
+	entry.CreatedAt = time.Now()
+	entry.Pending = true
+
+	if _, err := gCtx.Inst().Mongo.Collection(mongo.CollectionNameLedger).InsertOne(ctx, entry); err != nil {
+		if !mongo.IsDuplicateKeyError(err) {
+			return err
+		}
+
+		err = gCtx.Inst().Mongo.Collection(mongo.CollectionNameLedger).FindOne(ctx, bson.M{
+			"key":     entry.Key,
+			"pending": true,
+		}).Decode(&entry)
+		if err == mongo.ErrNoDocuments {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	balance, applied, err := apply(gCtx, ctx, entry)
+	if err != nil {
+		return err
+	}
+
+	if _, err := gCtx.Inst().Mongo.Collection(mongo.CollectionNameLedger).UpdateOne(ctx, bson.M{
+		"key": entry.Key,
+	}, bson.M{
+		"$unset": bson.M{"pending": 1},
+	}); err != nil {
+		return err
+	}
+
+	// the balance is stored, leaderboards catch up on the next change when this is lost.
+	if applied {
+		if err := feed.PublishBalance(gCtx, ctx, balance); err != nil {
+			logrus.Errorf("redis, err=%v", err)
+		}
+	}
+
+	return nil
+}
+
+// apply adds the entry to the balance of the user, unless its key is among the recent keys of the balance.
+// applied is false when an earlier attempt already added it.
+func apply(gCtx global.Context, ctx context.Context, entry structures.LedgerEntry) (structures.Balance, bool, error) {
+	inc := bson.M{
+		"balance": entry.Amount,
+		"entries": 1,
+	}
+	switch entry.Kind {
+	case structures.LedgerEntryKindRedemption:
+		inc["redeemed"] = entry.Amount
+	case structures.LedgerEntryKindRefund:
+		inc["refunded"] = -entry.Amount
+	case structures.LedgerEntryKindAdjustment:
+		inc["adjusted"] = entry.Amount
+	}
+
+	balance := structures.Balance{}
+	filter := bson.M{
+		"broadcaster_user_id": entry.BroadcasterUserID,
+		"user_id":             entry.UserID,
+		"recent_keys":         bson.M{"$ne": entry.Key},
+	}
+	update := bson.M{
+		"$inc": inc,
+		"$set": bson.M{
+			"updated_at": time.Now(),
+		},
+		"$push": bson.M{
+			"recent_keys": bson.M{"$each": []string{entry.Key}, "$slice": -balanceRecentKeys},
+		},
+	}
+
+	// the upsert fails on the unique index when the balance has the key, or when another entry created the balance first.
+	// the second attempt tells them apart.
+	var err error
+	for i := 0; i < 2; i++ {
+		res := gCtx.Inst().Mongo.Collection(mongo.CollectionNameBalances).FindOneAndUpdate(ctx, filter, update, options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After))
+		if err = res.Err(); err == nil {
+			err = res.Decode(&balance)
+		}
+		if !mongo.IsDuplicateKeyError(err) {
+			break
+		}
+	}
+	if mongo.IsDuplicateKeyError(err) {
+		return balance, false, nil
+	}
+
+	return balance, err == nil, err
+}
+
+// RecordRedemption enters the points a user spent on a redemption.
+func RecordRedemption(gCtx global.Context, ctx context.Context, broadcasterID string, ev structures.RedeemEvent) error {
+	return Record(gCtx, ctx, structures.LedgerEntry{
+		Key:               fmt.Sprintf("redemption:%s", ev.TwitchID),
+		BroadcasterUserID: broadcasterID,
+		UserID:            ev.UserID,
+		Kind:              structures.LedgerEntryKindRedemption,
+		Amount:            ev.Cost,
+		RewardID:          ev.RewardID,
+		RedemptionID:      ev.TwitchID,
+		OccurredAt:        ev.RedeemedAt,
+	})
+}
+
+// RecordRefund enters the points given back when a redemption was canceled at.
+func RecordRefund(gCtx global.Context, ctx context.Context, broadcasterID string, ev structures.RedeemEvent, at time.Time) error {
+	return Record(gCtx, ctx, structures.LedgerEntry{
+		Key:               fmt.Sprintf("refund:%s", ev.TwitchID),
+		BroadcasterUserID: broadcasterID,
+		UserID:            ev.UserID,
+		Kind:              structures.LedgerEntryKindRefund,
+		Amount:            -ev.Cost,
+		RewardID:          ev.RewardID,
+		RedemptionID:      ev.TwitchID,
+		OccurredAt:        at,
+	})
+}
+
+// RecordAdjustment enters a manual credit or debit, exemptions move no points and are not entered.
+func RecordAdjustment(gCtx global.Context, ctx context.Context, adj structures.Adjustment) error {
+	amount := adj.Amount
+	switch adj.Kind {
+	case structures.AdjustmentKindCredit:
+	case structures.AdjustmentKindDebit:
+		amount = -amount
+	default:
+		return nil
+	}
+
+	return Record(gCtx, ctx, structures.LedgerEntry{
+		Key:               fmt.Sprintf("adjustment:%s", adj.ID.Hex()),
+		BroadcasterUserID: adj.BroadcasterUserID,
+		UserID:            adj.UserID,
+		Kind:              structures.LedgerEntryKindAdjustment,
+		Amount:            amount,
+		AdjustmentID:      adj.ID,
+		OccurredAt:        adj.CreatedAt,
+	})
+}
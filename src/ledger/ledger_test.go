@@ -0,0 +1,130 @@
+package ledger
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/AdmiralBulldogTv/BulldogTax/src/configure"
+	"github.com/AdmiralBulldogTv/BulldogTax/src/feed"
+	"github.com/AdmiralBulldogTv/BulldogTax/src/structures"
+	"github.com/AdmiralBulldogTv/BulldogTax/src/testutil"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+var entry = structures.LedgerEntry{
+	Key:               "redemption:abc",
+	BroadcasterUserID: "1",
+	UserID:            "2",
+	Kind:              structures.LedgerEntryKindRedemption,
+	Amount:            500,
+	RedemptionID:      "abc",
+}
+
+func duplicateKey() bson.D {
+	return mtest.CreateWriteErrorsResponse(mtest.WriteError{Index: 0, Code: 11000, Message: "E11000 duplicate key error"})
+}
+
+func balance(amount int64) bson.D {
+	return mtest.CreateSuccessResponse(bson.E{Key: "value", Value: bson.D{
+		{Key: "broadcaster_user_id", Value: "1"},
+		{Key: "user_id", Value: "2"},
+		{Key: "balance", Value: amount},
+		{Key: "redeemed", Value: amount},
+		{Key: "entries", Value: int64(1)},
+	}})
+}
+
+func pending() bson.D {
+	return mtest.CreateCursorResponse(0, "db.ledger", mtest.FirstBatch, bson.D{
+		{Key: "key", Value: entry.Key},
+		{Key: "broadcaster_user_id", Value: entry.BroadcasterUserID},
+		{Key: "user_id", Value: entry.UserID},
+		{Key: "kind", Value: string(entry.Kind)},
+		{Key: "amount", Value: entry.Amount},
+		{Key: "pending", Value: true},
+	})
+}
+
+func TestRecord(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+
+	tests := []struct {
+		name      string
+		responses []bson.D
+		commands  []string
+		published bool
+	}{
+		{
+			name:      "new entry",
+			responses: []bson.D{mtest.CreateSuccessResponse(), balance(500), mtest.CreateSuccessResponse()},
+			commands:  []string{"insert", "findAndModify", "update"},
+			published: true,
+		},
+		{
+			name:      "recorded before",
+			responses: []bson.D{duplicateKey(), mtest.CreateCursorResponse(0, "db.ledger", mtest.FirstBatch)},
+			commands:  []string{"insert", "find"},
+		},
+		{
+			name:      "balance failed before",
+			responses: []bson.D{duplicateKey(), pending(), balance(500), mtest.CreateSuccessResponse()},
+			commands:  []string{"insert", "find", "findAndModify", "update"},
+			published: true,
+		},
+		{
+			name: "marking failed before",
+			responses: []bson.D{
+				duplicateKey(),
+				pending(),
+				mtest.CreateCommandErrorResponse(mtest.CommandError{Code: 11000, Message: "E11000 duplicate key error"}),
+				mtest.CreateCommandErrorResponse(mtest.CommandError{Code: 11000, Message: "E11000 duplicate key error"}),
+				mtest.CreateSuccessResponse(),
+			},
+			commands: []string{"insert", "find", "findAndModify", "findAndModify", "update"},
+		},
+	}
+
+	for _, tt := range tests {
+		mt.Run(tt.name, func(mt *mtest.T) {
+			gCtx, r := testutil.Context(mt, &configure.Config{})
+			mt.AddMockResponses(tt.responses...)
+
+			if err := Record(gCtx, mtest.Background, entry); err != nil {
+				mt.Fatalf("Record() err = %v", err)
+			}
+
+			commands := []string{}
+			for _, e := range mt.GetAllStartedEvents() {
+				commands = append(commands, e.CommandName)
+
+				// the balance is only changed when the key of the entry is not among the ones it has.
+				if e.CommandName == "findAndModify" {
+					query := e.Command.Lookup("query").Document()
+					if key := query.Lookup("recent_keys", "$ne").StringValue(); key != entry.Key {
+						mt.Errorf("balance query recent_keys $ne = %q, want %q", key, entry.Key)
+					}
+					update := e.Command.Lookup("update").Document()
+					if inc := update.Lookup("$inc", "balance").Int32(); inc != entry.Amount {
+						mt.Errorf("balance $inc = %d, want %d", inc, entry.Amount)
+					}
+				}
+			}
+			if strings.Join(commands, ",") != strings.Join(tt.commands, ",") {
+				mt.Errorf("commands = %v, want %v", commands, tt.commands)
+			}
+
+			published := r.Published()
+			if tt.published != (len(published) == 1) {
+				mt.Fatalf("published = %v, want published %v", published, tt.published)
+			}
+			if tt.published {
+				b := structures.Balance{}
+				if err := feed.Parse(published[0].Content, &b); err != nil || published[0].Channel != feed.ChannelBalances || b.Balance != 500 {
+					mt.Errorf("published %v, want the balance on %s", published[0], feed.ChannelBalances)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,101 @@
+package ledger
+
+import (
+	"context"
+
+	"github.com/AdmiralBulldogTv/BulldogTax/src/global"
+	"github.com/AdmiralBulldogTv/BulldogTax/src/mongo"
+	"github.com/AdmiralBulldogTv/BulldogTax/src/structures"
+	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// BroadcasterOf resolves the broadcaster of a stored redemption.
+type BroadcasterOf func(ev structures.RedeemEvent) (string, error)
+
+// Rebuild drops the ledger and balances, of one broadcaster when broadcasterID is set,
+// and enters every redemption in redeem_rewards and every adjustment again.
+func Rebuild(gCtx global.Context, ctx context.Context, broadcasterID string, broadcasterOf BroadcasterOf) error {
+	filter := bson.M{}
+	if broadcasterID != "" {
+		filter["broadcaster_user_id"] = broadcasterID
+	}
+
+	if _, err := gCtx.Inst().Mongo.Collection(mongo.CollectionNameLedger).DeleteMany(ctx, filter); err != nil {
+		return err
+	}
+	if _, err := gCtx.Inst().Mongo.Collection(mongo.CollectionNameBalances).DeleteMany(ctx, filter); err != nil {
+		return err
+	}
+
+	cur, err := gCtx.Inst().Mongo.Collection(mongo.CollectionNameRedeemRewards).Find(ctx, bson.M{})
+	if err != nil {
+		return err
+	}
+	defer cur.Close(ctx)
+
+	var redemptions, unknown int
+	for cur.Next(ctx) {
+		ev := structures.RedeemEvent{}
+		if err := cur.Decode(&ev); err != nil {
+			return err
+		}
+
+		id, err := broadcasterOf(ev)
+		if err != nil {
+			unknown++
+			logrus.Warnf("ledger, redemption=%s err=%v", ev.TwitchID, err)
+			continue
+		}
+		if broadcasterID != "" && id != broadcasterID {
+			continue
+		}
+
+		if err := RecordRedemption(gCtx, ctx, id, ev); err != nil {
+			return err
+		}
+		if ev.Status == structures.RedeemStatusCanceled {
+			at := ev.StatusChangedAt
+			if at.IsZero() {
+				at = ev.UpdatedAt
+			}
+			if at.IsZero() {
+				at = ev.RedeemedAt
+			}
+
+			if err := RecordRefund(gCtx, ctx, id, ev, at); err != nil {
+				return err
+			}
+		}
+		redemptions++
+	}
+	if err := cur.Err(); err != nil {
+		return err
+	}
+
+	cur, err = gCtx.Inst().Mongo.Collection(mongo.CollectionNameAdjustments).Find(ctx, filter)
+	if err != nil {
+		return err
+	}
+	defer cur.Close(ctx)
+
+	var adjustments int
+	for cur.Next(ctx) {
+		adj := structures.Adjustment{}
+		if err := cur.Decode(&adj); err != nil {
+			return err
+		}
+
+		if err := RecordAdjustment(gCtx, ctx, adj); err != nil {
+			return err
+		}
+		adjustments++
+	}
+	if err := cur.Err(); err != nil {
+		return err
+	}
+
+	logrus.Infof("ledger, rebuilt redemptions=%d adjustments=%d unknown_broadcaster=%d", redemptions, adjustments, unknown)
+
+	return nil
+}
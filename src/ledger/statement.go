@@ -0,0 +1,116 @@
+package ledger
+
+import (
+	"context"
+	"time"
+
+	"github.com/AdmiralBulldogTv/BulldogTax/src/global"
+	"github.com/AdmiralBulldogTv/BulldogTax/src/mongo"
+	"github.com/AdmiralBulldogTv/BulldogTax/src/structures"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type StatementLine struct {
+	structures.LedgerEntry
+	// Balance is the balance of the user after the entry.
+	Balance int64 `json:"balance"`
+}
+
+// Statement lists the ledger entries of a user in a window along with the balance before and after it.
+type Statement struct {
+	BroadcasterUserID string          `json:"broadcaster_user_id"`
+	UserID            string          `json:"user_id"`
+	Start             time.Time       `json:"start"`
+	End               time.Time       `json:"end"`
+	Opening           int64           `json:"opening"`
+	Closing           int64           `json:"closing"`
+	Lines             []StatementLine `json:"lines"`
+}
+
+// GetStatement builds the statement of the user for entries that occurred in [from, to).
+func GetStatement(gCtx global.Context, ctx context.Context, broadcasterID string, userID string, from time.Time, to time.Time) (Statement, error) {
+	st := Statement{
+		BroadcasterUserID: broadcasterID,
+		UserID:            userID,
+		Start:             from,
+		End:               to,
+		Lines:             []StatementLine{},
+	}
+
+	cur, err := gCtx.Inst().Mongo.Collection(mongo.CollectionNameLedger).Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{
+			"broadcaster_user_id": broadcasterID,
+			"user_id":             userID,
+			"occurred_at": bson.M{
+				"$lt": from,
+			},
+		}}},
+		{{Key: "$group", Value: bson.M{
+			"_id":     nil,
+			"balance": bson.M{"$sum": "$amount"},
+		}}},
+	})
+	opening := []struct {
+		Balance int64 `bson:"balance"`
+	}{}
+	if err == nil {
+		err = cur.All(ctx, &opening)
+	}
+	if err != nil {
+		return st, err
+	}
+	if len(opening) != 0 {
+		st.Opening = opening[0].Balance
+	}
+
+	cur, err = gCtx.Inst().Mongo.Collection(mongo.CollectionNameLedger).Find(ctx, bson.M{
+		"broadcaster_user_id": broadcasterID,
+		"user_id":             userID,
+		"occurred_at": bson.M{
+			"$gte": from,
+			"$lt":  to,
+		},
+	}, options.Find().SetSort(bson.D{{Key: "occurred_at", Value: 1}, {Key: "_id", Value: 1}}))
+	entries := []structures.LedgerEntry{}
+	if err == nil {
+		err = cur.All(ctx, &entries)
+	}
+	if err != nil {
+		return st, err
+	}
+
+	balance := st.Opening
+	for _, e := range entries {
+		balance += int64(e.Amount)
+		st.Lines = append(st.Lines, StatementLine{
+			LedgerEntry: e,
+			Balance:     balance,
+		})
+	}
+	st.Closing = balance
+
+	return st, nil
+}
+
+// Balances returns the balances of the broadcaster's users, highest first, or of one user when userID is set.
+func Balances(gCtx global.Context, ctx context.Context, broadcasterID string, userID string) ([]structures.Balance, error) {
+	filter := bson.M{
+		"broadcaster_user_id": broadcasterID,
+	}
+	if userID != "" {
+		filter["user_id"] = userID
+	}
+
+	cur, err := gCtx.Inst().Mongo.Collection(mongo.CollectionNameBalances).Find(ctx, filter, options.Find().SetSort(bson.D{
+		{Key: "balance", Value: -1},
+		{Key: "user_id", Value: 1},
+	}))
+
+	results := []structures.Balance{}
+	if err == nil {
+		err = cur.All(ctx, &results)
+	}
+
+	return results, err
+}
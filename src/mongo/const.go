@@ -5,4 +5,14 @@ import "github.com/AdmiralBulldogTv/BulldogTax/src/instance"
 const (
 	CollectionNameRedeemRewards instance.CollectionName = "redeem_rewards"
 	CollectionNameWebhooks      instance.CollectionName = "webhooks"
+	CollectionNameRawEvents     instance.CollectionName = "raw_events"
+	CollectionNameBroadcasters  instance.CollectionName = "broadcasters"
+	CollectionNameUserTokens    instance.CollectionName = "user_tokens"
+	CollectionNameRewards       instance.CollectionName = "rewards"
+	CollectionNameTaxRules      instance.CollectionName = "tax_rules"
+	CollectionNameRosters       instance.CollectionName = "rosters"
+	CollectionNameAdjustments   instance.CollectionName = "adjustments"
+	CollectionNameLedger        instance.CollectionName = "ledger"
+	CollectionNameBalances      instance.CollectionName = "balances"
+	CollectionNameAPIKeys       instance.CollectionName = "api_keys"
 )
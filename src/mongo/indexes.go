@@ -0,0 +1,67 @@
+package mongo
+
+import (
+	"context"
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var indexes = map[string][]IndexModel{
+	// twitch ids are idempotent, so every redemption and delivery is stored exactly once.
+	string(CollectionNameRedeemRewards): {
+		{Keys: bson.D{{Key: "twitch_id", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "reward_id", Value: 1}, {Key: "redeemed_at", Value: 1}, {Key: "_id", Value: 1}}},
+		{Keys: bson.D{{Key: "broadcaster_user_id", Value: 1}, {Key: "redeemed_at", Value: 1}, {Key: "_id", Value: 1}}},
+		// the compliance of a single user is worked out on every redemption of theirs.
+		{Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "reward_id", Value: 1}, {Key: "redeemed_at", Value: 1}}},
+	},
+	string(CollectionNameBroadcasters): {
+		{Keys: bson.D{{Key: "user_id", Value: 1}}, Options: options.Index().SetUnique(true)},
+	},
+	string(CollectionNameUserTokens): {
+		{Keys: bson.D{{Key: "user_id", Value: 1}}, Options: options.Index().SetUnique(true)},
+	},
+	string(CollectionNameRewards): {
+		{Keys: bson.D{{Key: "twitch_id", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "broadcaster_user_id", Value: 1}}},
+	},
+	string(CollectionNameTaxRules): {
+		{Keys: bson.D{{Key: "broadcaster_user_id", Value: 1}}},
+	},
+	string(CollectionNameRosters): {
+		{Keys: bson.D{{Key: "broadcaster_user_id", Value: 1}, {Key: "user_id", Value: 1}}, Options: options.Index().SetUnique(true)},
+	},
+	string(CollectionNameAdjustments): {
+		{Keys: bson.D{{Key: "tax_rule_id", Value: 1}, {Key: "period_start", Value: 1}}},
+	},
+	string(CollectionNameLedger): {
+		{Keys: bson.D{{Key: "key", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "broadcaster_user_id", Value: 1}, {Key: "user_id", Value: 1}, {Key: "occurred_at", Value: 1}}},
+	},
+	string(CollectionNameBalances): {
+		{Keys: bson.D{{Key: "broadcaster_user_id", Value: 1}, {Key: "user_id", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "broadcaster_user_id", Value: 1}, {Key: "balance", Value: -1}}},
+	},
+	string(CollectionNameAPIKeys): {
+		{Keys: bson.D{{Key: "hash", Value: 1}}, Options: options.Index().SetUnique(true)},
+	},
+	string(CollectionNameRawEvents): {
+		{Keys: bson.D{{Key: "message_id", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "broadcaster_user_id", Value: 1}, {Key: "received_at", Value: 1}}},
+	},
+}
+
+// createIndexes fails when a unique index cannot be built, because the collection already has duplicates,
+// we rely on those indexes to drop redeliveries so we do not start without them.
+func createIndexes(ctx context.Context, db *mongo.Database) error {
+	for name, models := range indexes {
+		if _, err := db.Collection(name).Indexes().CreateMany(ctx, models); err != nil {
+			return fmt.Errorf("failed to create indexes collection=%s, remove duplicates if there are any: %w", name, err)
+		}
+	}
+
+	return nil
+}
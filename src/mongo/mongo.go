@@ -12,6 +12,8 @@ import (
 
 var ErrNoDocuments = mongo.ErrNoDocuments
 
+var IsDuplicateKeyError = mongo.IsDuplicateKeyError
+
 func New(ctx context.Context, opt SetupOptions) (instance.Mongo, error) {
 	client, err := mongo.Connect(ctx, options.Client().ApplyURI(opt.URI).SetDirect(opt.Direct))
 	if err != nil {
@@ -24,6 +26,10 @@ func New(ctx context.Context, opt SetupOptions) (instance.Mongo, error) {
 
 	database := client.Database(opt.Database)
 
+	if err := createIndexes(ctx, database); err != nil {
+		return nil, err
+	}
+
 	logrus.Info("mongo, ok")
 
 	return &MongoInst{
@@ -44,4 +50,5 @@ type (
 	InsertOneModel = mongo.InsertOneModel
 	UpdateOneModel = mongo.UpdateOneModel
 	IndexModel     = mongo.IndexModel
+	UpdateResult   = mongo.UpdateResult
 )
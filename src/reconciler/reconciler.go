@@ -0,0 +1,195 @@
+package reconciler
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/AdmiralBulldogTv/BulldogTax/src/auth"
+	"github.com/AdmiralBulldogTv/BulldogTax/src/eventsub"
+	"github.com/AdmiralBulldogTv/BulldogTax/src/global"
+	"github.com/AdmiralBulldogTv/BulldogTax/src/mongo"
+	"github.com/AdmiralBulldogTv/BulldogTax/src/structures"
+	"github.com/AdmiralBulldogTv/BulldogTax/src/twitch"
+	"github.com/nicklaw5/helix"
+	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// StatusMissing is recorded for documents whose subscription no longer exists on twitch.
+const StatusMissing = "missing"
+
+// creatingGrace is how long a subscription without a twitch id is taken to still be created, rather than missing.
+const creatingGrace = time.Minute
+
+const lockKey = "twitch:eventsub:reconcile"
+
+// New periodically compares our webhook documents with the subscriptions twitch has for the app.
+func New(gCtx global.Context) <-chan struct{} {
+	interval := gCtx.Config().Twitch.EventSub.ReconcileInterval
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+
+		tick := time.NewTicker(interval)
+		defer tick.Stop()
+
+		for {
+			// only one instance reconciles per interval.
+			set, err := gCtx.Inst().Redis.SetNX(gCtx, lockKey, "1", interval/2)
+			if err != nil {
+				logrus.Errorf("redis, err=%v", err)
+			} else if set {
+				ctx, cancel := context.WithTimeout(gCtx, interval/2)
+				if err := Reconcile(gCtx, ctx); err != nil {
+					logrus.Errorf("reconcile, err=%v", err)
+				}
+				cancel()
+			}
+
+			select {
+			case <-gCtx.Done():
+				return
+			case <-tick.C:
+			}
+		}
+	}()
+
+	return done
+}
+
+// Reconcile recreates missing or failed subscriptions, deletes subscriptions we have no document for,
+// and records the status twitch reports on every document.
+func Reconcile(gCtx global.Context, ctx context.Context) error {
+	tkn, err := auth.GetAuth(gCtx, ctx)
+	if err != nil {
+		return err
+	}
+
+	api, err := helix.NewClient(&helix.Options{
+		ClientID:       gCtx.Config().Twitch.ClientID,
+		ClientSecret:   gCtx.Config().Twitch.ClientSecret,
+		APIBaseURL:     twitch.APIURL(gCtx),
+		AppAccessToken: tkn,
+	})
+	if err != nil {
+		return err
+	}
+
+	listedAt := time.Now()
+	subs, err := listSubscriptions(api)
+	if err != nil {
+		return err
+	}
+
+	cur, err := gCtx.Inst().Mongo.Collection(mongo.CollectionNameWebhooks).Find(ctx, bson.M{})
+	whs := []structures.WebHook{}
+	if err == nil {
+		err = cur.All(ctx, &whs)
+	}
+	if err != nil {
+		return err
+	}
+
+	known := map[string]bool{}
+	// creating broadcaster:type subscriptions, their documents are written before twitch has them.
+	creating := map[string]bool{}
+	for _, wh := range whs {
+		if wh.Transport == eventsub.TransportWebsocket {
+			// websocket subscriptions are not listed with the app token and end with their session.
+			continue
+		}
+
+		// a subscription created during the pass may be missing from the list, or not have its twitch id stored yet.
+		if wh.CreatedAt.After(listedAt) || (wh.TwitchID == "" && wh.CreatedAt.After(listedAt.Add(-creatingGrace))) {
+			creating[wh.UserID+":"+wh.Type] = true
+			continue
+		}
+
+		sub, ok := subs[wh.TwitchID]
+		known[wh.TwitchID] = true
+
+		status := StatusMissing
+		if ok {
+			status = sub.Status
+		}
+
+		if status == helix.EventSubStatusAuthorizationRevoked || status == helix.EventSubStatusUserRemoved {
+			logrus.Infof("reconcile, broadcaster revoked user=%s", wh.UserID)
+
+			if err := eventsub.RevokeBroadcaster(gCtx, ctx, wh.UserID); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if status != helix.EventSubStatusEnabled && status != helix.EventSubStatusPending {
+			logrus.Infof("reconcile, recreating subscription user=%s type=%s status=%s", wh.UserID, wh.Type, status)
+
+			if !ok {
+				// there is nothing left to remove on twitch.
+				wh.TwitchID = ""
+			}
+
+			nwh, err := eventsub.Resubscribe(gCtx, ctx, api, wh)
+			if err == nil {
+				known[nwh.TwitchID] = true
+				continue
+			}
+
+			logrus.Errorf("reconcile, failed to recreate subscription user=%s type=%s err=%v", wh.UserID, wh.Type, err)
+		}
+
+		if _, err := gCtx.Inst().Mongo.Collection(mongo.CollectionNameWebhooks).UpdateOne(ctx, bson.M{
+			"_id": wh.ID,
+		}, bson.M{
+			"$set": bson.M{
+				"status":     status,
+				"checked_at": time.Now(),
+			},
+		}); err != nil {
+			return err
+		}
+	}
+
+	callbackPrefix := fmt.Sprintf("%s/webhook/", gCtx.Config().Frontend.WebsiteURL)
+	for id, sub := range subs {
+		if known[id] || creating[sub.Condition.BroadcasterUserID+":"+sub.Type] || sub.Transport.Method != eventsub.TransportWebhook || !strings.HasPrefix(sub.Transport.Callback, callbackPrefix) {
+			continue
+		}
+
+		logrus.Infof("reconcile, deleting orphaned subscription id=%s type=%s broadcaster=%s", id, sub.Type, sub.Condition.BroadcasterUserID)
+
+		if _, err := api.RemoveEventSubSubscription(id); err != nil {
+			logrus.Errorf("reconcile, failed to delete subscription id=%s err=%v", id, err)
+		}
+	}
+
+	return nil
+}
+
+func listSubscriptions(api *helix.Client) (map[string]helix.EventSubSubscription, error) {
+	subs := map[string]helix.EventSubSubscription{}
+
+	params := &helix.EventSubSubscriptionsParams{}
+	for {
+		resp, err := api.GetEventSubSubscriptions(params)
+		if err != nil || resp.Error != "" {
+			if err == nil {
+				err = fmt.Errorf("%s %s %d", resp.Error, resp.ErrorMessage, resp.ErrorStatus)
+			}
+			return nil, err
+		}
+
+		for _, sub := range resp.Data.EventSubSubscriptions {
+			subs[sub.ID] = sub
+		}
+
+		if resp.Data.Pagination.Cursor == "" || len(resp.Data.EventSubSubscriptions) == 0 {
+			return subs, nil
+		}
+		params.After = resp.Data.Pagination.Cursor
+	}
+}
@@ -0,0 +1,191 @@
+package redemptions
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/AdmiralBulldogTv/BulldogTax/src/global"
+	"github.com/AdmiralBulldogTv/BulldogTax/src/ledger"
+	"github.com/AdmiralBulldogTv/BulldogTax/src/mongo"
+	"github.com/AdmiralBulldogTv/BulldogTax/src/structures"
+	"github.com/AdmiralBulldogTv/BulldogTax/src/taxes"
+	"github.com/AdmiralBulldogTv/BulldogTax/src/tokens"
+	"github.com/AdmiralBulldogTv/BulldogTax/src/twitch"
+	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ScopeManage is the scope required to change the status of redemptions.
+const ScopeManage = "channel:manage:redemptions"
+
+// ChangedByAuto is recorded for status changes made by the auto fulfill rule.
+const ChangedByAuto = "auto"
+
+var (
+	ErrUnknownBroadcaster = fmt.Errorf("broadcaster of the redemption is unknown")
+	ErrNotUnfulfilled     = fmt.Errorf("only unfulfilled redemptions can be updated")
+)
+
+// Broadcaster returns the broadcaster of a redemption. Redemptions stored before it was recorded
+// are looked up through the raw events they were stored from, or the stored reward.
+func Broadcaster(gCtx global.Context, ctx context.Context, ev structures.RedeemEvent) (string, error) {
+	if ev.BroadcasterUserID != "" {
+		return ev.BroadcasterUserID, nil
+	}
+
+	if len(ev.RawEventIDs) != 0 {
+		raw := structures.RawEvent{}
+		res := gCtx.Inst().Mongo.Collection(mongo.CollectionNameRawEvents).FindOne(ctx, bson.M{
+			"_id": bson.M{
+				"$in": ev.RawEventIDs,
+			},
+			"broadcaster_user_id": bson.M{
+				"$ne": "",
+			},
+		})
+		err := res.Err()
+		if err == nil {
+			err = res.Decode(&raw)
+		}
+		if err == nil {
+			return raw.BroadcasterUserID, nil
+		}
+		if err != mongo.ErrNoDocuments {
+			return "", err
+		}
+	}
+
+	reward := structures.Reward{}
+	res := gCtx.Inst().Mongo.Collection(mongo.CollectionNameRewards).FindOne(ctx, bson.M{
+		"twitch_id": ev.RewardID,
+	})
+	err := res.Err()
+	if err == nil {
+		err = res.Decode(&reward)
+	}
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return "", ErrUnknownBroadcaster
+		}
+		return "", err
+	}
+
+	return reward.BroadcasterUserID, nil
+}
+
+// SetStatus marks the redemption fulfilled or canceled on twitch with the broadcaster's token,
+// and records the resulting status and who changed it.
+func SetStatus(gCtx global.Context, ctx context.Context, broadcasterID string, ev structures.RedeemEvent, status structures.RedeemStatus, changedBy string) (structures.RedeemEvent, error) {
+	if ev.Status != structures.RedeemStatusUnfulfilled {
+		return ev, ErrNotUnfulfilled
+	}
+
+	token, err := tokens.ScopedAccessToken(gCtx, ctx, broadcasterID, ScopeManage)
+	if err != nil {
+		return ev, err
+	}
+
+	r, err := twitch.UpdateRedemptionStatus(gCtx, ctx, token, broadcasterID, ev.RewardID, ev.TwitchID, strings.ToUpper(string(status)))
+	if err != nil {
+		return ev, err
+	}
+
+	after := options.After
+	res := gCtx.Inst().Mongo.Collection(mongo.CollectionNameRedeemRewards).FindOneAndUpdate(ctx, bson.M{
+		"_id": ev.ID,
+	}, bson.M{
+		"$set": bson.M{
+			"status":            structures.RedeemStatus(strings.ToLower(r.Status)),
+			"status_changed_by": changedBy,
+			"status_changed_at": time.Now(),
+			"updated_at":        time.Now(),
+		},
+	}, &options.FindOneAndUpdateOptions{
+		ReturnDocument: &after,
+	})
+	err = res.Err()
+	if err == nil {
+		err = res.Decode(&ev)
+	}
+	if err != nil {
+		return ev, err
+	}
+
+	// twitch sends an update event too, the refund is entered once either way.
+	if ev.Status != structures.RedeemStatusCanceled {
+		return ev, nil
+	}
+
+	if err := ledger.RecordRefund(gCtx, ctx, broadcasterID, ev, ev.StatusChangedAt); err != nil {
+		return ev, err
+	}
+
+	if err := taxes.PublishCompliance(gCtx, ctx, broadcasterID, ev.RewardID, ev.UserID, ev.RedeemedAt); err != nil {
+		logrus.Errorf("taxes, err=%v", err)
+	}
+
+	return ev, nil
+}
+
+// AutoFulfill marks a newly stored redemption fulfilled when the auto fulfill rule covers its reward.
+func AutoFulfill(gCtx global.Context, ctx context.Context, broadcasterID string, twitchID string) {
+	rule := gCtx.Config().Redemptions.AutoFulfill
+	if !rule.Enabled {
+		return
+	}
+
+	ev := structures.RedeemEvent{}
+	res := gCtx.Inst().Mongo.Collection(mongo.CollectionNameRedeemRewards).FindOne(ctx, bson.M{
+		"twitch_id": twitchID,
+	})
+	err := res.Err()
+	if err == nil {
+		err = res.Decode(&ev)
+	}
+	if err != nil {
+		logrus.Errorf("mongo, err=%v", err)
+		return
+	}
+
+	if len(rule.RewardIDs) != 0 {
+		if !contains(rule.RewardIDs, ev.RewardID) {
+			return
+		}
+	} else {
+		// every reward we manage, twitch refuses to update the redemptions of the others.
+		reward := structures.Reward{}
+		res := gCtx.Inst().Mongo.Collection(mongo.CollectionNameRewards).FindOne(ctx, bson.M{
+			"twitch_id": ev.RewardID,
+		})
+		err := res.Err()
+		if err == nil {
+			err = res.Decode(&reward)
+		}
+		if err != nil {
+			if err != mongo.ErrNoDocuments {
+				logrus.Errorf("mongo, err=%v", err)
+			}
+			return
+		}
+		if !reward.Manageable {
+			return
+		}
+	}
+
+	if _, err := SetStatus(gCtx, ctx, broadcasterID, ev, structures.RedeemStatusFulfilled, ChangedByAuto); err != nil && err != ErrNotUnfulfilled {
+		logrus.Errorf("auto fulfill, redemption=%s err=%v", twitchID, err)
+	}
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+
+	return false
+}
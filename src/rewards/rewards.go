@@ -0,0 +1,154 @@
+package rewards
+
+import (
+	"context"
+	"time"
+
+	"github.com/AdmiralBulldogTv/BulldogTax/src/global"
+	"github.com/AdmiralBulldogTv/BulldogTax/src/mongo"
+	"github.com/AdmiralBulldogTv/BulldogTax/src/redemptions"
+	"github.com/AdmiralBulldogTv/BulldogTax/src/structures"
+	"github.com/AdmiralBulldogTv/BulldogTax/src/tokens"
+	"github.com/AdmiralBulldogTv/BulldogTax/src/twitch"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// List returns the stored rewards of the broadcaster.
+func List(gCtx global.Context, ctx context.Context, broadcasterID string) ([]structures.Reward, error) {
+	cur, err := gCtx.Inst().Mongo.Collection(mongo.CollectionNameRewards).Find(ctx, bson.M{
+		"broadcaster_user_id": broadcasterID,
+	}, options.Find().SetSort(bson.D{{Key: "cost", Value: 1}, {Key: "title", Value: 1}}))
+
+	results := []structures.Reward{}
+	if err == nil {
+		err = cur.All(ctx, &results)
+	}
+
+	return results, err
+}
+
+// Sync replaces the stored rewards of the broadcaster with the ones on twitch,
+// including rewards created in the dashboard which we can list but not manage.
+func Sync(gCtx global.Context, ctx context.Context, broadcasterID string) ([]structures.Reward, error) {
+	token, err := gCtx.Inst().Tokens.AccessToken(ctx, broadcasterID)
+	if err != nil {
+		return nil, err
+	}
+
+	all, err := twitch.GetRewards(gCtx, ctx, token, broadcasterID, false)
+	if err != nil {
+		return nil, err
+	}
+
+	manageable, err := twitch.GetRewards(gCtx, ctx, token, broadcasterID, true)
+	if err != nil {
+		return nil, err
+	}
+
+	managed := map[string]bool{}
+	for _, r := range manageable {
+		managed[r.ID] = true
+	}
+
+	ids := []string{}
+	for _, r := range all {
+		if _, err := store(gCtx, ctx, r, managed[r.ID]); err != nil {
+			return nil, err
+		}
+		ids = append(ids, r.ID)
+	}
+
+	if _, err := gCtx.Inst().Mongo.Collection(mongo.CollectionNameRewards).DeleteMany(ctx, bson.M{
+		"broadcaster_user_id": broadcasterID,
+		"twitch_id": bson.M{
+			"$nin": ids,
+		},
+	}); err != nil {
+		return nil, err
+	}
+
+	return List(gCtx, ctx, broadcasterID)
+}
+
+// Create creates a reward on twitch and stores it.
+func Create(gCtx global.Context, ctx context.Context, broadcasterID string, params twitch.RewardParams) (structures.Reward, error) {
+	token, err := manageToken(gCtx, ctx, broadcasterID)
+	if err != nil {
+		return structures.Reward{}, err
+	}
+
+	r, err := twitch.CreateReward(gCtx, ctx, token, broadcasterID, params)
+	if err != nil {
+		return structures.Reward{}, err
+	}
+
+	return store(gCtx, ctx, r, true)
+}
+
+// Update changes a reward on twitch and stores the result, pausing is an update of IsPaused.
+func Update(gCtx global.Context, ctx context.Context, broadcasterID string, rewardID string, params twitch.RewardParams) (structures.Reward, error) {
+	token, err := manageToken(gCtx, ctx, broadcasterID)
+	if err != nil {
+		return structures.Reward{}, err
+	}
+
+	r, err := twitch.UpdateReward(gCtx, ctx, token, broadcasterID, rewardID, params)
+	if err != nil {
+		return structures.Reward{}, err
+	}
+
+	return store(gCtx, ctx, r, true)
+}
+
+// Delete deletes a reward on twitch and from the store, its redemptions are kept.
+func Delete(gCtx global.Context, ctx context.Context, broadcasterID string, rewardID string) error {
+	token, err := manageToken(gCtx, ctx, broadcasterID)
+	if err != nil {
+		return err
+	}
+
+	if err := twitch.DeleteReward(gCtx, ctx, token, broadcasterID, rewardID); err != nil {
+		return err
+	}
+
+	_, err = gCtx.Inst().Mongo.Collection(mongo.CollectionNameRewards).DeleteOne(ctx, bson.M{
+		"broadcaster_user_id": broadcasterID,
+		"twitch_id":           rewardID,
+	})
+
+	return err
+}
+
+func manageToken(gCtx global.Context, ctx context.Context, broadcasterID string) (string, error) {
+	return tokens.ScopedAccessToken(gCtx, ctx, broadcasterID, redemptions.ScopeManage)
+}
+
+func store(gCtx global.Context, ctx context.Context, r twitch.Reward, manageable bool) (structures.Reward, error) {
+	res := gCtx.Inst().Mongo.Collection(mongo.CollectionNameRewards).FindOneAndUpdate(ctx, bson.M{
+		"twitch_id": r.ID,
+	}, bson.M{
+		"$set": bson.M{
+			"broadcaster_user_id": r.BroadcasterID,
+			"title":               r.Title,
+			"prompt":              r.Prompt,
+			"cost":                int32(r.Cost),
+			"background_color":    r.BackgroundColor,
+			"is_enabled":          r.IsEnabled,
+			"is_paused":           r.IsPaused,
+			"manageable":          manageable,
+			"updated_at":          time.Now(),
+		},
+		"$setOnInsert": bson.M{
+			"created_at": time.Now(),
+		},
+	}, options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After))
+
+	reward := structures.Reward{}
+	err := res.Err()
+	if err == nil {
+		err = res.Decode(&reward)
+	}
+
+	return reward, err
+}
@@ -0,0 +1,149 @@
+package roster
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/AdmiralBulldogTv/BulldogTax/src/global"
+	"github.com/AdmiralBulldogTv/BulldogTax/src/mongo"
+	"github.com/AdmiralBulldogTv/BulldogTax/src/structures"
+	"github.com/AdmiralBulldogTv/BulldogTax/src/tokens"
+	"github.com/AdmiralBulldogTv/BulldogTax/src/twitch"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var ErrUnknownSource = fmt.Errorf("source must be mods, vips or subs")
+
+// syncSources are the sources synced from helix, with the scope each of them requires.
+var syncSources = map[structures.RosterSource]struct {
+	scope string
+	list  func(gCtx global.Context, ctx context.Context, token string, broadcasterID string) ([]twitch.ChannelUser, error)
+}{
+	structures.RosterSourceModerators:  {"moderation:read", twitch.GetModerators},
+	structures.RosterSourceVIPs:        {"channel:read:vips", twitch.GetVIPs},
+	structures.RosterSourceSubscribers: {"channel:read:subscriptions", twitch.GetSubscribers},
+}
+
+// List returns the roster of the broadcaster.
+func List(gCtx global.Context, ctx context.Context, broadcasterID string) ([]structures.RosterMember, error) {
+	cur, err := gCtx.Inst().Mongo.Collection(mongo.CollectionNameRosters).Find(ctx, bson.M{
+		"broadcaster_user_id": broadcasterID,
+	}, options.Find().SetSort(bson.D{{Key: "user_id", Value: 1}}))
+
+	results := []structures.RosterMember{}
+	if err == nil {
+		err = cur.All(ctx, &results)
+	}
+
+	return results, err
+}
+
+// Add puts the users on the roster of the broadcaster, users already on it get source added to theirs.
+func Add(gCtx global.Context, ctx context.Context, broadcasterID string, source structures.RosterSource, users []twitch.ChannelUser) error {
+	if len(users) == 0 {
+		return nil
+	}
+
+	models := make([]mongo.WriteModel, len(users))
+	for i, u := range users {
+		set := bson.M{
+			"updated_at": time.Now(),
+		}
+		if u.UserLogin != "" {
+			set["user_login"] = u.UserLogin
+		}
+		if u.UserName != "" {
+			set["user_name"] = u.UserName
+		}
+
+		models[i] = &mongo.UpdateOneModel{
+			Filter: bson.M{
+				"broadcaster_user_id": broadcasterID,
+				"user_id":             u.UserID,
+			},
+			Update: bson.M{
+				"$set": set,
+				"$addToSet": bson.M{
+					"sources": source,
+				},
+				"$setOnInsert": bson.M{
+					"added_at": time.Now(),
+				},
+			},
+			Upsert: options.Update().SetUpsert(true).Upsert,
+		}
+	}
+
+	_, err := gCtx.Inst().Mongo.Collection(mongo.CollectionNameRosters).BulkWrite(ctx, models)
+	return err
+}
+
+// Remove takes the user off the roster of the broadcaster, whatever added them.
+func Remove(gCtx global.Context, ctx context.Context, broadcasterID string, userID string) (bool, error) {
+	res, err := gCtx.Inst().Mongo.Collection(mongo.CollectionNameRosters).DeleteOne(ctx, bson.M{
+		"broadcaster_user_id": broadcasterID,
+		"user_id":             userID,
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return res.DeletedCount != 0, nil
+}
+
+// Sync replaces the members of a source with the current mods, vips or subs of the channel.
+// Members who were also added another way stay on the roster.
+func Sync(gCtx global.Context, ctx context.Context, broadcasterID string, source structures.RosterSource) (int, error) {
+	s, ok := syncSources[source]
+	if !ok {
+		return 0, ErrUnknownSource
+	}
+
+	token, err := tokens.ScopedAccessToken(gCtx, ctx, broadcasterID, s.scope)
+	if err != nil {
+		return 0, err
+	}
+
+	users, err := s.list(gCtx, ctx, token, broadcasterID)
+	if err != nil {
+		return 0, err
+	}
+
+	// the broadcaster is listed as their own subscriber.
+	members := make([]twitch.ChannelUser, 0, len(users))
+	ids := make([]string, 0, len(users))
+	for _, u := range users {
+		if u.UserID != broadcasterID {
+			members = append(members, u)
+			ids = append(ids, u.UserID)
+		}
+	}
+
+	if err := Add(gCtx, ctx, broadcasterID, source, members); err != nil {
+		return 0, err
+	}
+
+	if _, err := gCtx.Inst().Mongo.Collection(mongo.CollectionNameRosters).UpdateMany(ctx, bson.M{
+		"broadcaster_user_id": broadcasterID,
+		"user_id": bson.M{
+			"$nin": ids,
+		},
+	}, bson.M{
+		"$pull": bson.M{
+			"sources": source,
+		},
+	}); err != nil {
+		return 0, err
+	}
+
+	_, err = gCtx.Inst().Mongo.Collection(mongo.CollectionNameRosters).DeleteMany(ctx, bson.M{
+		"broadcaster_user_id": broadcasterID,
+		"sources": bson.M{
+			"$size": 0,
+		},
+	})
+
+	return len(ids), err
+}
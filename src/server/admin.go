@@ -0,0 +1,570 @@
+package server
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/AdmiralBulldogTv/BulldogTax/src/global"
+	"github.com/AdmiralBulldogTv/BulldogTax/src/mongo"
+	"github.com/AdmiralBulldogTv/BulldogTax/src/redemptions"
+	"github.com/AdmiralBulldogTv/BulldogTax/src/rewards"
+	"github.com/AdmiralBulldogTv/BulldogTax/src/roster"
+	"github.com/AdmiralBulldogTv/BulldogTax/src/structures"
+	"github.com/AdmiralBulldogTv/BulldogTax/src/taxes"
+	"github.com/AdmiralBulldogTv/BulldogTax/src/tokens"
+	"github.com/AdmiralBulldogTv/BulldogTax/src/twitch"
+	"github.com/gofiber/fiber/v2"
+	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func Admin(gCtx global.Context, app fiber.Router) {
+	admin := allow(gCtx, structures.APIKeyPermissionAdmin, "")
+	adminOf := allow(gCtx, structures.APIKeyPermissionAdmin, "id")
+	rules := allow(gCtx, structures.APIKeyPermissionManageRules, "")
+
+	app.Get("/broadcasters", admin, func(c *fiber.Ctx) error {
+		filter := bson.M{}
+		if status := c.Query("status"); status != "" {
+			filter["status"] = status
+		}
+		if broadcasterID := c.Query("broadcaster_id"); broadcasterID != "" {
+			filter["user_id"] = broadcasterID
+		}
+
+		cur, err := gCtx.Inst().Mongo.Collection(mongo.CollectionNameBroadcasters).Find(c.Context(), filter)
+
+		results := []structures.Broadcaster{}
+		if err == nil {
+			err = cur.All(c.Context(), &results)
+		}
+		if err != nil {
+			logrus.Errorf("mongo, err=%v", err)
+			return err
+		}
+
+		return c.JSON(results)
+	})
+
+	app.Get("/broadcasters/:id", adminOf, func(c *fiber.Ctx) error {
+		broadcaster := structures.Broadcaster{}
+		res := gCtx.Inst().Mongo.Collection(mongo.CollectionNameBroadcasters).FindOne(c.Context(), bson.M{
+			"user_id": c.Params("id"),
+		})
+		err := res.Err()
+		if err == nil {
+			err = res.Decode(&broadcaster)
+		}
+		if err != nil {
+			if err == mongo.ErrNoDocuments {
+				return c.SendStatus(404)
+			}
+			logrus.Errorf("mongo, err=%v", err)
+			return err
+		}
+
+		cur, err := gCtx.Inst().Mongo.Collection(mongo.CollectionNameWebhooks).Find(c.Context(), bson.M{
+			"user_id": broadcaster.UserID,
+		})
+
+		webhooks := []structures.WebHook{}
+		if err == nil {
+			err = cur.All(c.Context(), &webhooks)
+		}
+		if err != nil {
+			logrus.Errorf("mongo, err=%v", err)
+			return err
+		}
+
+		scopes, err := gCtx.Inst().Tokens.Scopes(c.Context(), broadcaster.UserID)
+		if err != nil && err != mongo.ErrNoDocuments {
+			logrus.Errorf("mongo, err=%v", err)
+			return err
+		}
+		if scopes == nil {
+			scopes = []string{}
+		}
+
+		return c.JSON(fiber.Map{
+			"broadcaster": broadcaster,
+			"webhooks":    webhooks,
+			"scopes":      scopes,
+		})
+	})
+	setStatus := func(status structures.RedeemStatus) fiber.Handler {
+		return func(c *fiber.Ctx) error {
+			body := struct {
+				// ChangedBy is who asked for the change, usually the mod clearing the queue.
+				ChangedBy string `json:"changed_by"`
+				// BroadcasterID is required for redemptions that were not delivered by eventsub.
+				BroadcasterID string `json:"broadcaster_id"`
+			}{}
+			if len(c.Body()) != 0 {
+				if err := json.Unmarshal(c.Body(), &body); err != nil {
+					return c.SendStatus(400)
+				}
+			}
+			if body.ChangedBy == "" {
+				return c.Status(400).JSON(&fiber.Map{
+					"status":  400,
+					"message": "changed_by is required.",
+				})
+			}
+
+			ev := structures.RedeemEvent{}
+			res := gCtx.Inst().Mongo.Collection(mongo.CollectionNameRedeemRewards).FindOne(c.Context(), bson.M{
+				"twitch_id": c.Params("id"),
+			})
+			err := res.Err()
+			if err == nil {
+				err = res.Decode(&ev)
+			}
+			if err != nil {
+				if err == mongo.ErrNoDocuments {
+					return c.SendStatus(404)
+				}
+				logrus.Errorf("mongo, err=%v", err)
+				return err
+			}
+
+			broadcasterID := body.BroadcasterID
+			if broadcasterID == "" {
+				broadcasterID, err = redemptions.Broadcaster(gCtx, c.Context(), ev)
+				if err != nil {
+					if err == redemptions.ErrUnknownBroadcaster {
+						return c.Status(400).JSON(&fiber.Map{
+							"status":  400,
+							"message": "The broadcaster of this redemption is unknown, pass broadcaster_id.",
+						})
+					}
+					logrus.Errorf("mongo, err=%v", err)
+					return err
+				}
+			}
+			if !permitted(c, broadcasterID) || (ev.BroadcasterUserID != "" && !permitted(c, ev.BroadcasterUserID)) {
+				return c.SendStatus(403)
+			}
+
+			ev, err = redemptions.SetStatus(gCtx, c.Context(), broadcasterID, ev, status, body.ChangedBy)
+			if err != nil {
+				switch err {
+				case redemptions.ErrNotUnfulfilled:
+					return c.Status(409).JSON(&fiber.Map{
+						"status":  409,
+						"message": err.Error(),
+					})
+				}
+				return twitchError(c, err)
+			}
+
+			return c.JSON(fiber.Map{
+				"twitch_id":         ev.TwitchID,
+				"status":            ev.Status,
+				"status_changed_by": ev.StatusChangedBy,
+				"status_changed_at": ev.StatusChangedAt,
+			})
+		}
+	}
+
+	app.Post("/redemptions/:id/fulfill", admin, setStatus(structures.RedeemStatusFulfilled))
+	app.Post("/redemptions/:id/cancel", admin, setStatus(structures.RedeemStatusCanceled))
+
+	app.Post("/broadcasters/:id/rewards/sync", adminOf, func(c *fiber.Ctx) error {
+		results, err := rewards.Sync(gCtx, c.Context(), c.Params("id"))
+		if err != nil {
+			return twitchError(c, err)
+		}
+
+		return c.JSON(results)
+	})
+
+	app.Post("/broadcasters/:id/rewards", adminOf, func(c *fiber.Ctx) error {
+		params := twitch.RewardParams{}
+		if err := json.Unmarshal(c.Body(), &params); err != nil || params.Title == nil || params.Cost == nil {
+			return c.Status(400).JSON(&fiber.Map{
+				"status":  400,
+				"message": "title and cost are required.",
+			})
+		}
+
+		reward, err := rewards.Create(gCtx, c.Context(), c.Params("id"), params)
+		if err != nil {
+			return twitchError(c, err)
+		}
+
+		return c.Status(201).JSON(reward)
+	})
+
+	updateReward := func(c *fiber.Ctx, params twitch.RewardParams) error {
+		reward, err := rewards.Update(gCtx, c.Context(), c.Params("id"), c.Params("reward"), params)
+		if err != nil {
+			return twitchError(c, err)
+		}
+
+		return c.JSON(reward)
+	}
+
+	app.Patch("/broadcasters/:id/rewards/:reward", adminOf, func(c *fiber.Ctx) error {
+		params := twitch.RewardParams{}
+		if err := json.Unmarshal(c.Body(), &params); err != nil {
+			return c.SendStatus(400)
+		}
+
+		return updateReward(c, params)
+	})
+
+	app.Post("/broadcasters/:id/rewards/:reward/pause", adminOf, func(c *fiber.Ctx) error {
+		paused := true
+		return updateReward(c, twitch.RewardParams{IsPaused: &paused})
+	})
+
+	app.Post("/broadcasters/:id/rewards/:reward/resume", adminOf, func(c *fiber.Ctx) error {
+		paused := false
+		return updateReward(c, twitch.RewardParams{IsPaused: &paused})
+	})
+
+	app.Delete("/broadcasters/:id/rewards/:reward", adminOf, func(c *fiber.Ctx) error {
+		if err := rewards.Delete(gCtx, c.Context(), c.Params("id"), c.Params("reward")); err != nil {
+			return twitchError(c, err)
+		}
+
+		return c.SendStatus(204)
+	})
+
+	app.Get("/broadcasters/:id/roster", adminOf, func(c *fiber.Ctx) error {
+		results, err := roster.List(gCtx, c.Context(), c.Params("id"))
+		if err != nil {
+			logrus.Errorf("mongo, err=%v", err)
+			return err
+		}
+
+		return c.JSON(results)
+	})
+
+	app.Post("/broadcasters/:id/roster", adminOf, func(c *fiber.Ctx) error {
+		body := struct {
+			Users []twitch.ChannelUser `json:"users"`
+		}{}
+		if err := json.Unmarshal(c.Body(), &body); err != nil {
+			return c.SendStatus(400)
+		}
+		for _, u := range body.Users {
+			if u.UserID == "" {
+				return c.Status(400).JSON(&fiber.Map{
+					"status":  400,
+					"message": "user_id is required.",
+				})
+			}
+		}
+
+		if err := roster.Add(gCtx, c.Context(), c.Params("id"), structures.RosterSourceManual, body.Users); err != nil {
+			logrus.Errorf("mongo, err=%v", err)
+			return err
+		}
+
+		return c.SendStatus(204)
+	})
+
+	// import takes a csv of user_id,user_login,user_name, only the id is required.
+	app.Post("/broadcasters/:id/roster/import", adminOf, func(c *fiber.Ctx) error {
+		reader := csv.NewReader(bytes.NewReader(c.Body()))
+		reader.FieldsPerRecord = -1
+
+		records, err := reader.ReadAll()
+		if err != nil {
+			return c.Status(400).JSON(&fiber.Map{
+				"status":  400,
+				"message": "Invalid csv.",
+				"error":   err.Error(),
+			})
+		}
+
+		users := []twitch.ChannelUser{}
+		for _, record := range records {
+			u := twitch.ChannelUser{UserID: strings.TrimSpace(record[0])}
+			if u.UserID == "" || u.UserID == "user_id" {
+				continue
+			}
+			if len(record) > 1 {
+				u.UserLogin = strings.TrimSpace(record[1])
+			}
+			if len(record) > 2 {
+				u.UserName = strings.TrimSpace(record[2])
+			}
+			users = append(users, u)
+		}
+
+		if err := roster.Add(gCtx, c.Context(), c.Params("id"), structures.RosterSourceImport, users); err != nil {
+			logrus.Errorf("mongo, err=%v", err)
+			return err
+		}
+
+		return c.JSON(fiber.Map{
+			"imported": len(users),
+		})
+	})
+
+	app.Post("/broadcasters/:id/roster/sync", adminOf, func(c *fiber.Ctx) error {
+		n, err := roster.Sync(gCtx, c.Context(), c.Params("id"), structures.RosterSource(c.Query("source")))
+		if err != nil {
+			if err == roster.ErrUnknownSource {
+				return c.Status(400).JSON(&fiber.Map{
+					"status":  400,
+					"message": err.Error(),
+				})
+			}
+			return twitchError(c, err)
+		}
+
+		return c.JSON(fiber.Map{
+			"synced": n,
+		})
+	})
+
+	app.Delete("/broadcasters/:id/roster/:user", adminOf, func(c *fiber.Ctx) error {
+		ok, err := roster.Remove(gCtx, c.Context(), c.Params("id"), c.Params("user"))
+		if err != nil {
+			logrus.Errorf("mongo, err=%v", err)
+			return err
+		}
+		if !ok {
+			return c.SendStatus(404)
+		}
+
+		return c.SendStatus(204)
+	})
+
+	app.Get("/tax-rules", rules, func(c *fiber.Ctx) error {
+		filter := bson.M{}
+		if broadcasterID := c.Query("broadcaster_id"); broadcasterID != "" {
+			filter["broadcaster_user_id"] = broadcasterID
+		}
+
+		cur, err := gCtx.Inst().Mongo.Collection(mongo.CollectionNameTaxRules).Find(c.Context(), filter)
+
+		results := []structures.TaxRule{}
+		if err == nil {
+			err = cur.All(c.Context(), &results)
+		}
+		if err != nil {
+			logrus.Errorf("mongo, err=%v", err)
+			return err
+		}
+
+		return c.JSON(results)
+	})
+
+	app.Post("/tax-rules", rules, func(c *fiber.Ctx) error {
+		rule := structures.TaxRule{}
+		if err := json.Unmarshal(c.Body(), &rule); err != nil {
+			return c.SendStatus(400)
+		}
+		if err := taxes.Validate(rule); err != nil {
+			return c.Status(400).JSON(&fiber.Map{
+				"status":  400,
+				"message": err.Error(),
+			})
+		}
+		if !permitted(c, rule.BroadcasterUserID) {
+			return c.SendStatus(403)
+		}
+		if err := taxes.ValidateRewards(gCtx, c.Context(), rule); err != nil {
+			if errors.Is(err, taxes.ErrForeignReward) {
+				return c.Status(400).JSON(&fiber.Map{
+					"status":  400,
+					"message": err.Error(),
+				})
+			}
+			logrus.Errorf("mongo, err=%v", err)
+			return err
+		}
+
+		rule.ID = primitive.NewObjectID()
+		rule.CreatedAt = time.Now()
+		rule.UpdatedAt = rule.CreatedAt
+		if _, err := gCtx.Inst().Mongo.Collection(mongo.CollectionNameTaxRules).InsertOne(c.Context(), rule); err != nil {
+			logrus.Errorf("mongo, err=%v", err)
+			return err
+		}
+
+		return c.Status(201).JSON(rule)
+	})
+
+	app.Put("/tax-rules/:id", rules, func(c *fiber.Ctx) error {
+		old, err := taxes.GetRule(gCtx, c.Context(), c.Params("id"))
+		if err != nil {
+			if err == mongo.ErrNoDocuments {
+				return c.SendStatus(404)
+			}
+			logrus.Errorf("mongo, err=%v", err)
+			return err
+		}
+		if !permitted(c, old.BroadcasterUserID) {
+			return c.SendStatus(403)
+		}
+
+		rule := structures.TaxRule{}
+		if err := json.Unmarshal(c.Body(), &rule); err != nil {
+			return c.SendStatus(400)
+		}
+		if err := taxes.Validate(rule); err != nil {
+			return c.Status(400).JSON(&fiber.Map{
+				"status":  400,
+				"message": err.Error(),
+			})
+		}
+		if !permitted(c, rule.BroadcasterUserID) {
+			return c.SendStatus(403)
+		}
+		if err := taxes.ValidateRewards(gCtx, c.Context(), rule); err != nil {
+			if errors.Is(err, taxes.ErrForeignReward) {
+				return c.Status(400).JSON(&fiber.Map{
+					"status":  400,
+					"message": err.Error(),
+				})
+			}
+			logrus.Errorf("mongo, err=%v", err)
+			return err
+		}
+
+		rule.ID = old.ID
+		rule.CreatedAt = old.CreatedAt
+		rule.UpdatedAt = time.Now()
+		if _, err := gCtx.Inst().Mongo.Collection(mongo.CollectionNameTaxRules).ReplaceOne(c.Context(), bson.M{
+			"_id": rule.ID,
+		}, rule); err != nil {
+			logrus.Errorf("mongo, err=%v", err)
+			return err
+		}
+
+		return c.JSON(rule)
+	})
+
+	app.Delete("/tax-rules/:id", rules, func(c *fiber.Ctx) error {
+		rule, err := taxes.GetRule(gCtx, c.Context(), c.Params("id"))
+		if err != nil {
+			if err == mongo.ErrNoDocuments {
+				return c.SendStatus(404)
+			}
+			logrus.Errorf("mongo, err=%v", err)
+			return err
+		}
+		if !permitted(c, rule.BroadcasterUserID) {
+			return c.SendStatus(403)
+		}
+
+		if _, err := gCtx.Inst().Mongo.Collection(mongo.CollectionNameTaxRules).DeleteOne(c.Context(), bson.M{
+			"_id": rule.ID,
+		}); err != nil {
+			logrus.Errorf("mongo, err=%v", err)
+			return err
+		}
+
+		return c.SendStatus(204)
+	})
+
+	app.Get("/tax-rules/:id/adjustments", rules, func(c *fiber.Ctx) error {
+		rule, err := taxes.GetRule(gCtx, c.Context(), c.Params("id"))
+		if err != nil {
+			if err == mongo.ErrNoDocuments {
+				return c.SendStatus(404)
+			}
+			logrus.Errorf("mongo, err=%v", err)
+			return err
+		}
+		if !permitted(c, rule.BroadcasterUserID) {
+			return c.SendStatus(403)
+		}
+
+		startDate, endDate := rule.EffectiveFrom, time.Now().AddDate(100, 0, 0)
+		if start := c.Query("start_date"); start != "" {
+			if startDate, err = time.Parse(time.RFC3339, start); err != nil {
+				return c.SendStatus(400)
+			}
+		}
+		if end := c.Query("end_date"); end != "" {
+			if endDate, err = time.Parse(time.RFC3339, end); err != nil {
+				return c.SendStatus(400)
+			}
+		}
+
+		results, err := taxes.Adjustments(gCtx, c.Context(), rule, startDate, endDate, c.Query("user_id"))
+		if err != nil {
+			logrus.Errorf("mongo, err=%v", err)
+			return err
+		}
+
+		return c.JSON(results)
+	})
+
+	app.Post("/tax-rules/:id/adjustments", rules, func(c *fiber.Ctx) error {
+		rule, err := taxes.GetRule(gCtx, c.Context(), c.Params("id"))
+		if err != nil {
+			if err == mongo.ErrNoDocuments {
+				return c.SendStatus(404)
+			}
+			logrus.Errorf("mongo, err=%v", err)
+			return err
+		}
+		if !permitted(c, rule.BroadcasterUserID) {
+			return c.SendStatus(403)
+		}
+
+		body := struct {
+			structures.Adjustment
+			// Period is any time in the period the adjustment is for.
+			Period time.Time `json:"period"`
+		}{}
+		if err := json.Unmarshal(c.Body(), &body); err != nil {
+			return c.SendStatus(400)
+		}
+		if err := taxes.ValidateAdjustment(body.Adjustment); err != nil {
+			return c.Status(400).JSON(&fiber.Map{
+				"status":  400,
+				"message": err.Error(),
+			})
+		}
+		if body.Period.IsZero() {
+			body.Period = time.Now()
+		}
+
+		adj, err := taxes.AddAdjustment(gCtx, c.Context(), rule, body.Adjustment, body.Period)
+		if err != nil {
+			logrus.Errorf("mongo, err=%v", err)
+			return err
+		}
+
+		return c.Status(201).JSON(adj)
+	})
+}
+
+// twitchError responds to errors of calls made to helix on behalf of a broadcaster.
+func twitchError(c *fiber.Ctx, err error) error {
+	switch err {
+	case tokens.ErrMissingScope, tokens.ErrNeedsRelogin, mongo.ErrNoDocuments:
+		return c.Status(403).JSON(&fiber.Map{
+			"status":  403,
+			"message": "The broadcaster needs to login again.",
+			"error":   err.Error(),
+		})
+	}
+
+	if e, ok := err.(*twitch.Error); ok {
+		if e.Status == 404 {
+			return c.SendStatus(404)
+		}
+
+		return c.Status(502).JSON(&fiber.Map{
+			"status":  502,
+			"message": "Invalid response from twitch.",
+			"error":   e.Error(),
+		})
+	}
+
+	logrus.Errorf("twitch, err=%v", err)
+	return err
+}
@@ -0,0 +1,66 @@
+package server
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/AdmiralBulldogTv/BulldogTax/src/configure"
+	"github.com/AdmiralBulldogTv/BulldogTax/src/testutil"
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestCreateRule(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+
+	reward := func(id string) bson.D {
+		return bson.D{{Key: "twitch_id", Value: id}, {Key: "broadcaster_user_id", Value: "1"}}
+	}
+	const body = `{"broadcaster_user_id":"1","name":"tax","reward_ids":["a","b"],"recurrence":"daily","effective_from":"2022-03-01T00:00:00Z"}`
+
+	tests := []struct {
+		name      string
+		body      string
+		responses []bson.D
+		status    int
+	}{
+		{"rewards of the broadcaster", body, []bson.D{mtest.CreateCursorResponse(0, "db.rewards", mtest.FirstBatch, reward("a"), reward("b")), mtest.CreateSuccessResponse()}, 201},
+		{"reward of another broadcaster", body, []bson.D{mtest.CreateCursorResponse(0, "db.rewards", mtest.FirstBatch, reward("a"))}, 400},
+		{"no broadcaster", `{"name":"tax","reward_ids":["a"],"recurrence":"daily","effective_from":"2022-03-01T00:00:00Z"}`, nil, 400},
+	}
+
+	for _, tt := range tests {
+		mt.Run(tt.name, func(mt *mtest.T) {
+			config := &configure.Config{}
+			config.API.AdminKey = "admin"
+			gCtx, _ := testutil.Context(mt, config)
+			mt.AddMockResponses(tt.responses...)
+
+			app := fiber.New()
+			Admin(gCtx, app)
+
+			req := httptest.NewRequest("POST", "/tax-rules", bytes.NewReader([]byte(tt.body)))
+			req.Header.Set("Authorization", "Bearer admin")
+			resp, err := app.Test(req)
+			if err != nil {
+				mt.Fatalf("request err = %v", err)
+			}
+			if resp.StatusCode != tt.status {
+				mt.Fatalf("status = %d, want %d", resp.StatusCode, tt.status)
+			}
+
+			if len(tt.responses) != 0 {
+				find := mt.GetStartedEvent()
+				if broadcaster := find.Command.Lookup("filter", "broadcaster_user_id").StringValue(); broadcaster != "1" {
+					mt.Errorf("rewards filter broadcaster_user_id = %q, want the broadcaster of the rule", broadcaster)
+				}
+			}
+			if inserted := mt.GetStartedEvent(); (inserted != nil) != (tt.status == 201) {
+				mt.Errorf("inserted = %v, want inserted %v", inserted, tt.status == 201)
+			}
+		})
+	}
+}
@@ -1,43 +1,145 @@
 package server
 
 import (
+	"context"
+	"strconv"
 	"time"
 
+	"github.com/AdmiralBulldogTv/BulldogTax/src/export"
 	"github.com/AdmiralBulldogTv/BulldogTax/src/global"
+	"github.com/AdmiralBulldogTv/BulldogTax/src/ledger"
 	"github.com/AdmiralBulldogTv/BulldogTax/src/mongo"
+	"github.com/AdmiralBulldogTv/BulldogTax/src/rewards"
 	"github.com/AdmiralBulldogTv/BulldogTax/src/structures"
+	"github.com/AdmiralBulldogTv/BulldogTax/src/taxes"
 	"github.com/gofiber/fiber/v2"
 	"github.com/sirupsen/logrus"
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 func API(gCtx global.Context, app fiber.Router) {
-	app.Get("/tax-results", func(c *fiber.Ctx) error {
-		rewardID := c.Query("reward_id")
-		start := c.Query("start_date")
-		end := c.Query("end_date")
-		if start == "" || end == "" || rewardID == "" {
+	read := allow(gCtx, structures.APIKeyPermissionReadResults, "")
+
+	app.Get("/tax-results", read, func(c *fiber.Ctx) error {
+		filter, ok := resultsFilter(c)
+		if !ok {
 			return c.SendStatus(400)
 		}
 
-		startDate, err := time.Parse(time.RFC3339, start)
+		format, err := exportFormat(c)
 		if err != nil {
-			logrus.Error(err)
 			return c.SendStatus(400)
 		}
-		endDate, err := time.Parse(time.RFC3339, end)
-		if err != nil {
-			logrus.Error(err)
+
+		order := 1
+		switch c.Query("sort", "asc") {
+		case "asc":
+		case "desc":
+			order = -1
+		default:
 			return c.SendStatus(400)
 		}
 
-		cur, err := gCtx.Inst().Mongo.Collection(mongo.CollectionNameRedeemRewards).Find(c.Context(), bson.M{
-			"reward_id": rewardID,
-			"redeemed_at": bson.M{
-				"$gte": startDate,
-				"$lte": endDate,
-			},
-		})
+		// exports hold every result, streamed from the cursor.
+		if format != export.FormatJSON {
+			extra, ok := extraColumns(c)
+			if !ok {
+				return c.SendStatus(400)
+			}
+
+			columns := append([]string{"user_id", "cost", "status", "redeemed_at"}, extra...)
+			return streamExport(gCtx, c, format, "tax-results", columns, func(ctx context.Context, w export.Writer) error {
+				cur, err := gCtx.Inst().Mongo.Collection(mongo.CollectionNameRedeemRewards).Find(ctx, filter, options.Find().
+					SetSort(bson.D{{Key: "redeemed_at", Value: order}, {Key: "_id", Value: order}}))
+				if err != nil {
+					return err
+				}
+				defer cur.Close(ctx)
+
+				row := make([]interface{}, len(columns))
+				for cur.Next(ctx) {
+					ev := structures.RedeemEvent{}
+					if err := cur.Decode(&ev); err != nil {
+						return err
+					}
+
+					row = append(row[:0], ev.UserID, ev.Cost, string(ev.Status), ev.RedeemedAt)
+					for _, col := range extra {
+						switch col {
+						case "broadcaster_user_id":
+							row = append(row, ev.BroadcasterUserID)
+						case "broadcaster_login":
+							row = append(row, ev.BroadcasterLogin)
+						case "reward_id":
+							row = append(row, ev.RewardID)
+						case "reward_name":
+							row = append(row, ev.RewardName)
+						case "user_name":
+							row = append(row, ev.UserName)
+						case "twitch_id":
+							row = append(row, ev.TwitchID)
+						}
+					}
+
+					if err := w.Row(row...); err != nil {
+						return err
+					}
+				}
+
+				return cur.Err()
+			})
+		}
+
+		// pages are only returned when asked for, without a limit or cursor every result is returned in a single array.
+		limit := c.Query("limit")
+		cursor := c.Query("cursor")
+		if limit == "" && cursor == "" {
+			cur, err := gCtx.Inst().Mongo.Collection(mongo.CollectionNameRedeemRewards).Find(c.Context(), filter, options.Find().
+				SetSort(bson.D{{Key: "redeemed_at", Value: order}, {Key: "_id", Value: order}}))
+
+			results := []structures.RedeemEvent{}
+			if err == nil {
+				err = cur.All(c.Context(), &results)
+			}
+			if err != nil {
+				logrus.Errorf("mongo, err=%v", err)
+				return err
+			}
+
+			data, err := json.Marshal(results)
+			if err != nil {
+				logrus.Errorf("json, err=%v", err)
+				return err
+			}
+
+			c.Set("Content-Type", "application/json")
+
+			return c.Send(data)
+		}
+
+		n := defaultResultsLimit
+		if limit != "" {
+			var err error
+			if n, err = strconv.Atoi(limit); err != nil || n < 1 || n > maxResultsLimit {
+				return c.SendStatus(400)
+			}
+		}
+
+		if cursor != "" {
+			after, err := cursorFilter(cursor, order == -1)
+			if err != nil {
+				return c.SendStatus(400)
+			}
+			filter = bson.M{
+				"$and": bson.A{filter, after},
+			}
+		}
+
+		// one more than the limit tells whether there is a next page.
+		cur, err := gCtx.Inst().Mongo.Collection(mongo.CollectionNameRedeemRewards).Find(c.Context(), filter, options.Find().
+			SetSort(bson.D{{Key: "redeemed_at", Value: order}, {Key: "_id", Value: order}}).
+			SetLimit(int64(n+1)))
 
 		results := []structures.RedeemEvent{}
 		if err == nil {
@@ -48,14 +150,324 @@ func API(gCtx global.Context, app fiber.Router) {
 			return err
 		}
 
-		data, err := json.Marshal(results)
+		next := ""
+		if len(results) > n {
+			results = results[:n]
+			next = encodeCursor(results[n-1])
+		}
+
+		return c.JSON(fiber.Map{
+			"data":        results,
+			"next_cursor": next,
+		})
+	})
+
+	app.Get("/tax-results/users", read, func(c *fiber.Ctx) error {
+		filter, ok := resultsFilter(c)
+		if !ok {
+			return c.SendStatus(400)
+		}
+
+		sortField, ok := userTotalsSort[c.Query("sort", "total_cost")]
+		if !ok {
+			return c.SendStatus(400)
+		}
+
+		order := -1
+		switch c.Query("order", "desc") {
+		case "desc":
+		case "asc":
+			order = 1
+		default:
+			return c.SendStatus(400)
+		}
+
+		n := 0
+		if limit := c.Query("limit"); limit != "" {
+			var err error
+			if n, err = strconv.Atoi(limit); err != nil || n < 1 || n > maxResultsLimit {
+				return c.SendStatus(400)
+			}
+		}
+
+		format, err := exportFormat(c)
+		if err != nil {
+			return c.SendStatus(400)
+		}
+
+		pipeline, err := userTotalsPipeline(gCtx, c.Context(), filter)
+		if err != nil {
+			logrus.Errorf("mongo, err=%v", err)
+			return err
+		}
+		pipeline = append(pipeline, bson.D{{Key: "$sort", Value: bson.D{{Key: sortField, Value: order}, {Key: "_id", Value: 1}}}})
+		if n != 0 {
+			pipeline = append(pipeline, bson.D{{Key: "$limit", Value: n}})
+		}
+		if format != export.FormatJSON {
+			columns := []string{"user_id", "user_name", "count", "total_cost", "first_redeemed_at", "last_redeemed_at"}
+			return streamExport(gCtx, c, format, "tax-results-users", columns, func(ctx context.Context, w export.Writer) error {
+				cur, err := gCtx.Inst().Mongo.Collection(mongo.CollectionNameRedeemRewards).Aggregate(ctx, pipeline, options.Aggregate().SetAllowDiskUse(true))
+				if err != nil {
+					return err
+				}
+				defer cur.Close(ctx)
+
+				for cur.Next(ctx) {
+					t := userTotal{}
+					if err := cur.Decode(&t); err != nil {
+						return err
+					}
+
+					if err := w.Row(t.UserID, t.UserName, t.Count, t.TotalCost, t.First, t.Last); err != nil {
+						return err
+					}
+				}
+
+				return cur.Err()
+			})
+		}
+
+		cur, err := gCtx.Inst().Mongo.Collection(mongo.CollectionNameRedeemRewards).Aggregate(c.Context(), pipeline, options.Aggregate().SetAllowDiskUse(true))
+
+		results := []userTotal{}
+		if err == nil {
+			err = cur.All(c.Context(), &results)
+		}
 		if err != nil {
-			logrus.Errorf("json, err=%v", err)
+			logrus.Errorf("mongo, err=%v", err)
 			return err
 		}
 
-		c.Set("Content-Type", "application/json")
+		return c.JSON(results)
+	})
+
+	app.Get("/tax-results/histogram", read, func(c *fiber.Ctx) error {
+		filter, ok := resultsFilter(c)
+		if !ok {
+			return c.SendStatus(400)
+		}
+
+		// the end is exclusive, so it does not open a bucket of its own.
+		startDate, _ := time.Parse(time.RFC3339, c.Query("start_date"))
+		endDate, _ := time.Parse(time.RFC3339, c.Query("end_date"))
+		if !endDate.After(startDate) {
+			return c.SendStatus(400)
+		}
+		filter["redeemed_at"] = bson.M{
+			"$gte": startDate,
+			"$lt":  endDate,
+		}
+
+		tz := c.Query("tz", "UTC")
+		loc, err := time.LoadLocation(tz)
+		// the zone is passed on to mongo, which knows none by the name go gives the zone of the server.
+		if err != nil || loc.String() == "Local" || loc.String() == "" {
+			return c.SendStatus(400)
+		}
+
+		format, err := exportFormat(c)
+		if err != nil {
+			return c.SendStatus(400)
+		}
+
+		interval := c.Query("interval", "day")
+		buckets, err := histogramBuckets(interval, startDate, endDate, loc)
+		if err != nil {
+			return c.Status(400).JSON(&fiber.Map{
+				"status":  400,
+				"message": err.Error(),
+			})
+		}
+
+		cur, err := gCtx.Inst().Mongo.Collection(mongo.CollectionNameRedeemRewards).Aggregate(c.Context(), mongo.Pipeline{
+			{{Key: "$match", Value: filter}},
+			{{Key: "$group", Value: bson.M{
+				"_id": bson.M{
+					"$dateToParts": bson.M{
+						"date":     "$redeemed_at",
+						"timezone": tz,
+						"iso8601":  interval == "week",
+					},
+				},
+				"count":      bson.M{"$sum": 1},
+				"total_cost": bson.M{"$sum": "$cost"},
+			}}},
+		})
+
+		groups := []histogramGroup{}
+		if err == nil {
+			err = cur.All(c.Context(), &groups)
+		}
+		if err != nil {
+			logrus.Errorf("mongo, err=%v", err)
+			return err
+		}
+
+		index := map[string]int{}
+		for i, b := range buckets {
+			index[bucketKey(interval, b.Start)] = i
+		}
+		for _, g := range groups {
+			if i, ok := index[g.key(interval)]; ok {
+				buckets[i].Count += g.Count
+				buckets[i].TotalCost += g.TotalCost
+			}
+		}
+
+		if format != export.FormatJSON {
+			return streamExport(gCtx, c, format, "tax-results-histogram", []string{"start", "count", "total_cost"}, func(ctx context.Context, w export.Writer) error {
+				for _, b := range buckets {
+					if err := w.Row(b.Start, b.Count, b.TotalCost); err != nil {
+						return err
+					}
+				}
+
+				return nil
+			})
+		}
+
+		return c.JSON(fiber.Map{
+			"interval": interval,
+			"tz":       tz,
+			"buckets":  buckets,
+		})
+	})
+
+	app.Get("/rewards", read, func(c *fiber.Ctx) error {
+		broadcasterID := c.Query("broadcaster_id")
+		if broadcasterID == "" {
+			return c.SendStatus(400)
+		}
+
+		results, err := rewards.List(gCtx, c.Context(), broadcasterID)
+		if err != nil {
+			logrus.Errorf("mongo, err=%v", err)
+			return err
+		}
+
+		return c.JSON(results)
+	})
+	app.Get("/tax-rules/:id/compliance", read, func(c *fiber.Ctx) error {
+		rule, err := taxes.GetRule(gCtx, c.Context(), c.Params("id"))
+		if err != nil {
+			if err == mongo.ErrNoDocuments {
+				return c.SendStatus(404)
+			}
+			logrus.Errorf("mongo, err=%v", err)
+			return err
+		}
+		if !permitted(c, rule.BroadcasterUserID) {
+			return c.SendStatus(403)
+		}
+
+		// the current period when no window is given.
+		startDate, endDate := time.Now(), time.Now()
+		if start := c.Query("start_date"); start != "" {
+			if startDate, err = time.Parse(time.RFC3339, start); err != nil {
+				return c.SendStatus(400)
+			}
+		}
+		if end := c.Query("end_date"); end != "" {
+			if endDate, err = time.Parse(time.RFC3339, end); err != nil {
+				return c.SendStatus(400)
+			}
+		}
+		if endDate.Before(startDate) {
+			return c.SendStatus(400)
+		}
+		if endDate.Equal(startDate) {
+			endDate = endDate.Add(time.Nanosecond)
+		}
+
+		periods, err := taxes.Evaluate(gCtx, c.Context(), rule, startDate, endDate, nil)
+		if err != nil {
+			if err == taxes.ErrNoBroadcaster || err == taxes.ErrTooManyPeriods {
+				return c.Status(400).JSON(&fiber.Map{
+					"status":  400,
+					"message": err.Error(),
+				})
+			}
+			logrus.Errorf("taxes, err=%v", err)
+			return err
+		}
+
+		return c.JSON(fiber.Map{
+			"rule":    rule,
+			"periods": periods,
+		})
+	})
+	app.Get("/tax-rules/:id/delinquents", read, func(c *fiber.Ctx) error {
+		rule, err := taxes.GetRule(gCtx, c.Context(), c.Params("id"))
+		if err != nil {
+			if err == mongo.ErrNoDocuments {
+				return c.SendStatus(404)
+			}
+			logrus.Errorf("mongo, err=%v", err)
+			return err
+		}
+		if !permitted(c, rule.BroadcasterUserID) {
+			return c.SendStatus(403)
+		}
+
+		at := time.Now()
+		if period := c.Query("period"); period != "" {
+			if at, err = time.Parse(time.RFC3339, period); err != nil {
+				return c.SendStatus(400)
+			}
+		}
+
+		report, err := taxes.Delinquents(gCtx, c.Context(), rule, at)
+		if err != nil {
+			if err == taxes.ErrNoBroadcaster || err == taxes.ErrTooManyPeriods {
+				return c.Status(400).JSON(&fiber.Map{
+					"status":  400,
+					"message": err.Error(),
+				})
+			}
+			logrus.Errorf("taxes, err=%v", err)
+			return err
+		}
+
+		return c.JSON(report)
+	})
+	app.Get("/balances", read, func(c *fiber.Ctx) error {
+		broadcasterID := c.Query("broadcaster_id")
+		if broadcasterID == "" {
+			return c.SendStatus(400)
+		}
+
+		results, err := ledger.Balances(gCtx, c.Context(), broadcasterID, c.Query("user_id"))
+		if err != nil {
+			logrus.Errorf("mongo, err=%v", err)
+			return err
+		}
+
+		return c.JSON(results)
+	})
+
+	app.Get("/balances/:broadcaster/:user/statement", allow(gCtx, structures.APIKeyPermissionReadResults, "broadcaster"), func(c *fiber.Ctx) error {
+		var err error
+
+		// everything up to now when no window is given.
+		startDate, endDate := time.Time{}, time.Now()
+		if start := c.Query("start_date"); start != "" {
+			if startDate, err = time.Parse(time.RFC3339, start); err != nil {
+				return c.SendStatus(400)
+			}
+		}
+		if end := c.Query("end_date"); end != "" {
+			if endDate, err = time.Parse(time.RFC3339, end); err != nil {
+				return c.SendStatus(400)
+			}
+		}
+
+		st, err := ledger.GetStatement(gCtx, c.Context(), c.Params("broadcaster"), c.Params("user"), startDate, endDate)
+		if err != nil {
+			logrus.Errorf("mongo, err=%v", err)
+			return err
+		}
 
-		return c.Send(data)
+		return c.JSON(st)
 	})
 }
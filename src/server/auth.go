@@ -0,0 +1,91 @@
+package server
+
+import (
+	"crypto/subtle"
+	"strings"
+
+	"github.com/AdmiralBulldogTv/BulldogTax/src/apikeys"
+	"github.com/AdmiralBulldogTv/BulldogTax/src/global"
+	"github.com/AdmiralBulldogTv/BulldogTax/src/structures"
+	"github.com/AdmiralBulldogTv/BulldogTax/src/utils"
+	"github.com/gofiber/fiber/v2"
+	"github.com/sirupsen/logrus"
+)
+
+// apiKeyLocal is where allow leaves the key of the request for the handler.
+const apiKeyLocal = "api_key"
+
+// adminKey stands in for the admin key of the config, which can do everything.
+var adminKey = structures.APIKey{
+	Name:        "admin_key",
+	Permissions: []structures.APIKeyPermission{structures.APIKeyPermissionAdmin},
+}
+
+// requestToken is the bearer token of the request. Browsers cannot set headers on a websocket,
+// so the token parameter is taken when there is none.
+func requestToken(c *fiber.Ctx) string {
+	if auth := c.Get("Authorization"); auth != "" {
+		return strings.TrimPrefix(auth, "Bearer ")
+	}
+
+	return c.Query("token")
+}
+
+// allow lets requests with the admin key, or an api key with the permission, through. A key scoped to a broadcaster
+// only reaches theirs: through the route param when one is named, and through the broadcaster_id parameter,
+// which is set to theirs when the request has none.
+func allow(gCtx global.Context, perm structures.APIKeyPermission, param string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		token := requestToken(c)
+		if token == "" {
+			return c.SendStatus(401)
+		}
+
+		key := adminKey
+		if admin := gCtx.Config().API.AdminKey; admin == "" || subtle.ConstantTimeCompare(utils.S2B(token), utils.S2B(admin)) != 1 {
+			var err error
+			if key, err = apikeys.Lookup(gCtx, c.Context(), token); err != nil {
+				if err == apikeys.ErrInvalidKey {
+					return c.SendStatus(401)
+				}
+				logrus.Errorf("mongo, err=%v", err)
+				return err
+			}
+		}
+
+		if !apikeys.Can(key, perm) {
+			return c.SendStatus(403)
+		}
+
+		if key.BroadcasterUserID != "" {
+			if param != "" && c.Params(param) != key.BroadcasterUserID {
+				return c.SendStatus(403)
+			}
+
+			ids := queryList(c, "broadcaster_id")
+			for _, id := range ids {
+				if id != key.BroadcasterUserID {
+					return c.SendStatus(403)
+				}
+			}
+			if len(ids) == 0 {
+				c.Context().QueryArgs().Set("broadcaster_id", key.BroadcasterUserID)
+			}
+		}
+
+		c.Locals(apiKeyLocal, key)
+		return c.Next()
+	}
+}
+
+// requestKey is the key allow let the request through with.
+func requestKey(c *fiber.Ctx) (structures.APIKey, bool) {
+	key, ok := c.Locals(apiKeyLocal).(structures.APIKey)
+	return key, ok
+}
+
+// permitted reports whether the key of the request reaches the data of the broadcaster.
+func permitted(c *fiber.Ctx, broadcasterID string) bool {
+	key, ok := requestKey(c)
+	return ok && apikeys.Allows(key, broadcasterID)
+}
@@ -0,0 +1,91 @@
+package server
+
+import (
+	"io/ioutil"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/AdmiralBulldogTv/BulldogTax/src/configure"
+	"github.com/AdmiralBulldogTv/BulldogTax/src/structures"
+	"github.com/AdmiralBulldogTv/BulldogTax/src/testutil"
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestAllow(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+
+	const key = "btx_0123456789abcdef"
+	storedKey := func(broadcasterID string, perms ...structures.APIKeyPermission) bson.D {
+		permissions := bson.A{}
+		for _, p := range perms {
+			permissions = append(permissions, string(p))
+		}
+
+		return mtest.CreateCursorResponse(0, "db.api_keys", mtest.FirstBatch, bson.D{
+			{Key: "name", Value: "test"},
+			{Key: "broadcaster_user_id", Value: broadcasterID},
+			{Key: "permissions", Value: permissions},
+		})
+	}
+	noKey := mtest.CreateCursorResponse(0, "db.api_keys", mtest.FirstBatch)
+
+	tests := []struct {
+		name     string
+		path     string
+		token    string
+		lookup   []bson.D
+		status   int
+		queryGot string
+	}{
+		{"no token", "/broadcasters/1", "", nil, 401, ""},
+		{"admin key", "/broadcasters/1?broadcaster_id=2", "admin", nil, 200, "2"},
+		{"not a key", "/broadcasters/1", "nope", nil, 401, ""},
+		{"revoked key", "/broadcasters/1", key, []bson.D{noKey}, 401, ""},
+		{"missing permission", "/rules", key, []bson.D{storedKey("", structures.APIKeyPermissionReadResults)}, 403, ""},
+		{"permission", "/rules", key, []bson.D{storedKey("", structures.APIKeyPermissionManageRules)}, 200, ""},
+		{"admin permission", "/rules", key, []bson.D{storedKey("", structures.APIKeyPermissionAdmin)}, 200, ""},
+		{"unscoped key", "/broadcasters/1?broadcaster_id=2", key, []bson.D{storedKey("", structures.APIKeyPermissionReadResults)}, 200, "2"},
+		{"scoped to the param", "/broadcasters/1", key, []bson.D{storedKey("1", structures.APIKeyPermissionReadResults)}, 200, "1"},
+		{"scoped to another param", "/broadcasters/2", key, []bson.D{storedKey("1", structures.APIKeyPermissionReadResults)}, 403, ""},
+		{"scoped to the query", "/results?broadcaster_id=1", key, []bson.D{storedKey("1", structures.APIKeyPermissionReadResults)}, 200, "1"},
+		{"scoped to another query", "/results?broadcaster_id=1,2", key, []bson.D{storedKey("1", structures.APIKeyPermissionReadResults)}, 403, ""},
+		{"scoped without a query", "/results", key, []bson.D{storedKey("1", structures.APIKeyPermissionReadResults)}, 200, "1"},
+	}
+
+	for _, tt := range tests {
+		mt.Run(tt.name, func(mt *mtest.T) {
+			config := &configure.Config{}
+			config.API.AdminKey = "admin"
+			gCtx, _ := testutil.Context(mt, config)
+			mt.AddMockResponses(tt.lookup...)
+
+			echo := func(c *fiber.Ctx) error {
+				return c.SendString(c.Query("broadcaster_id"))
+			}
+			app := fiber.New()
+			app.Get("/broadcasters/:id", allow(gCtx, structures.APIKeyPermissionReadResults, "id"), echo)
+			app.Get("/results", allow(gCtx, structures.APIKeyPermissionReadResults, ""), echo)
+			app.Get("/rules", allow(gCtx, structures.APIKeyPermissionManageRules, ""), echo)
+
+			req := httptest.NewRequest("GET", tt.path, nil)
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			resp, err := app.Test(req)
+			if err != nil {
+				mt.Fatalf("request err = %v", err)
+			}
+			if resp.StatusCode != tt.status {
+				mt.Fatalf("status = %d, want %d", resp.StatusCode, tt.status)
+			}
+
+			body, _ := ioutil.ReadAll(resp.Body)
+			if tt.status == 200 && string(body) != tt.queryGot {
+				mt.Errorf("broadcaster_id = %q, want %q", body, tt.queryGot)
+			}
+		})
+	}
+}
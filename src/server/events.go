@@ -0,0 +1,127 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/AdmiralBulldogTv/BulldogTax/src/feed"
+	"github.com/AdmiralBulldogTv/BulldogTax/src/global"
+	"github.com/AdmiralBulldogTv/BulldogTax/src/structures"
+	"github.com/gofiber/fiber/v2"
+	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// eventsHeartbeat is how often an idle feed sends a comment, so proxies and the write timeout keep it open.
+const eventsHeartbeat = time.Second * 15
+
+func Events(gCtx global.Context, app fiber.Router) {
+	app.Get("/events", allow(gCtx, structures.APIKeyPermissionReadResults, ""), func(c *fiber.Ctx) error {
+		filter := feed.Filter{
+			BroadcasterIDs: queryList(c, "broadcaster_id"),
+			RewardIDs:      queryList(c, "reward_id"),
+		}
+		if len(filter.BroadcasterIDs) == 0 && len(filter.RewardIDs) == 0 {
+			return c.SendStatus(400)
+		}
+
+		// browsers send the header when they reconnect, the parameter lets a client resume on its first connect.
+		var (
+			after primitive.ObjectID
+			err   error
+		)
+		resume := c.Get("Last-Event-ID", c.Query("last_event_id"))
+		if resume != "" {
+			if after, err = primitive.ObjectIDFromHex(resume); err != nil {
+				return c.SendStatus(400)
+			}
+		}
+
+		c.Set("Content-Type", "text/event-stream")
+		c.Set("Cache-Control", "no-cache")
+		c.Set("Connection", "keep-alive")
+		c.Set("X-Accel-Buffering", "no")
+
+		conn := c.Context().Conn()
+		c.Context().SetBodyStreamWriter(func(bw *bufio.Writer) {
+			ctx, cancel := context.WithCancel(gCtx)
+			defer cancel()
+
+			dw := &deadlineWriter{
+				conn:    conn,
+				w:       bw,
+				timeout: time.Second * 10,
+			}
+
+			// subscribed before the stored redemptions are read, so none fall in between.
+			// the ones read from both are skipped by their id.
+			ch := make(chan string, 100)
+			gCtx.Inst().Redis.Subscribe(ctx, ch, feed.ChannelRedemptions)
+			replayed := feed.Replayed{}
+
+			send := func(e feed.Event) error {
+				data, err := json.Marshal(e)
+				if err != nil {
+					return err
+				}
+				if _, err := fmt.Fprintf(dw, "id: %s\nevent: redemption\ndata: %s\n\n", e.ID.Hex(), data); err != nil {
+					return err
+				}
+
+				return bw.Flush()
+			}
+
+			_, err := fmt.Fprint(dw, "retry: 3000\n\n")
+			if err == nil {
+				err = bw.Flush()
+			}
+			if err == nil && !after.IsZero() {
+				err = feed.Since(gCtx, ctx, filter, after, func(e feed.Event) error {
+					replayed.Add(e.ID)
+					return send(e)
+				})
+			}
+			if err != nil {
+				logrus.Errorf("events, err=%v", err)
+				return
+			}
+
+			ticker := time.NewTicker(eventsHeartbeat)
+			defer ticker.Stop()
+
+			overlap := time.NewTimer(feed.ReplayOverlap)
+			defer overlap.Stop()
+
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case <-overlap.C:
+					replayed = nil
+				case <-ticker.C:
+					if _, err = fmt.Fprint(dw, ": heartbeat\n\n"); err == nil {
+						err = bw.Flush()
+					}
+				case payload := <-ch:
+					e := feed.Event{}
+					if perr := feed.Parse(payload, &e); perr != nil {
+						logrus.Errorf("events, err=%v", perr)
+						continue
+					}
+					if !filter.Match(e) || replayed.Skip(e) {
+						continue
+					}
+					err = send(e)
+				}
+				// the client is gone.
+				if err != nil {
+					return
+				}
+			}
+		})
+
+		return nil
+	})
+}
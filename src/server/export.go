@@ -0,0 +1,99 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/AdmiralBulldogTv/BulldogTax/src/export"
+	"github.com/AdmiralBulldogTv/BulldogTax/src/global"
+	"github.com/gofiber/fiber/v2"
+	"github.com/sirupsen/logrus"
+)
+
+// exportTimeout bounds how long an export can stream, the write timeout is extended while it does.
+const exportTimeout = time.Minute * 30
+
+// resultsExtraColumns are the fields of redemptions the json response hides, which an export can add.
+var resultsExtraColumns = map[string]bool{
+	"broadcaster_user_id": true,
+	"broadcaster_login":   true,
+	"reward_id":           true,
+	"reward_name":         true,
+	"user_name":           true,
+	"twitch_id":           true,
+}
+
+// exportFormat is the format the request asks for, json when it asks for none.
+func exportFormat(c *fiber.Ctx) (string, error) {
+	return export.Negotiate(c.Query("format"), c.Get("Accept"))
+}
+
+// extraColumns parses the columns parameter, false means one of them cannot be exported.
+func extraColumns(c *fiber.Ctx) ([]string, bool) {
+	columns := []string{}
+	for _, col := range strings.Split(c.Query("columns"), ",") {
+		col = strings.TrimSpace(col)
+		if col == "" {
+			continue
+		}
+		if !resultsExtraColumns[col] {
+			return nil, false
+		}
+		columns = append(columns, col)
+	}
+
+	return columns, true
+}
+
+// deadlineWriter pushes the write deadline of the connection forward on every write,
+// so a long export is not cut off by the write timeout of the server.
+type deadlineWriter struct {
+	conn    net.Conn
+	w       *bufio.Writer
+	timeout time.Duration
+}
+
+func (d *deadlineWriter) Write(p []byte) (int, error) {
+	_ = d.conn.SetWriteDeadline(time.Now().Add(d.timeout))
+	return d.w.Write(p)
+}
+
+// streamExport responds with a file of the format, fill writes its rows after the handler returned
+// so it must not use the request context.
+func streamExport(gCtx global.Context, c *fiber.Ctx, format string, name string, columns []string, fill func(ctx context.Context, w export.Writer) error) error {
+	c.Set("Content-Type", export.ContentType(format))
+	c.Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.%s"`, name, format))
+
+	conn := c.Context().Conn()
+	c.Context().SetBodyStreamWriter(func(bw *bufio.Writer) {
+		ctx, cancel := context.WithTimeout(gCtx, exportTimeout)
+		defer cancel()
+
+		dw := &deadlineWriter{
+			conn:    conn,
+			w:       bw,
+			timeout: time.Second * 10,
+		}
+
+		w, err := export.NewWriter(format, dw, columns)
+		if err == nil {
+			err = fill(ctx, w)
+			if cerr := w.Close(); err == nil {
+				err = cerr
+			}
+		}
+		if err == nil {
+			err = bw.Flush()
+		}
+		// the status is sent already, the file is cut short.
+		if err != nil {
+			logrus.Errorf("export, err=%v", err)
+		}
+	})
+
+	return nil
+}
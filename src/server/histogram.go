@@ -0,0 +1,94 @@
+package server
+
+import (
+	"fmt"
+	"time"
+)
+
+const maxHistogramBuckets = 5000
+
+type histogramBucket struct {
+	Start     time.Time `json:"start"`
+	Count     int32     `json:"count"`
+	TotalCost int64     `json:"total_cost"`
+}
+
+// histogramGroup is a group of the histogram aggregation, keyed on the $dateToParts of the redemptions.
+type histogramGroup struct {
+	ID struct {
+		Year        int `bson:"year"`
+		Month       int `bson:"month"`
+		Day         int `bson:"day"`
+		Hour        int `bson:"hour"`
+		ISOWeekYear int `bson:"isoWeekYear"`
+		ISOWeek     int `bson:"isoWeek"`
+	} `bson:"_id"`
+	Count     int32 `bson:"count"`
+	TotalCost int64 `bson:"total_cost"`
+}
+
+func (g histogramGroup) key(interval string) string {
+	switch interval {
+	case "hour":
+		return fmt.Sprintf("%d-%d-%d-%d", g.ID.Year, g.ID.Month, g.ID.Day, g.ID.Hour)
+	case "week":
+		return fmt.Sprintf("%d-w%d", g.ID.ISOWeekYear, g.ID.ISOWeek)
+	case "month":
+		return fmt.Sprintf("%d-%d", g.ID.Year, g.ID.Month)
+	}
+
+	return fmt.Sprintf("%d-%d-%d", g.ID.Year, g.ID.Month, g.ID.Day)
+}
+
+// bucketKey is the key of the group the redemptions of the bucket starting at t fall in, t is in the time zone of the histogram.
+func bucketKey(interval string, t time.Time) string {
+	switch interval {
+	case "hour":
+		return fmt.Sprintf("%d-%d-%d-%d", t.Year(), t.Month(), t.Day(), t.Hour())
+	case "week":
+		year, week := t.ISOWeek()
+		return fmt.Sprintf("%d-w%d", year, week)
+	case "month":
+		return fmt.Sprintf("%d-%d", t.Year(), t.Month())
+	}
+
+	return fmt.Sprintf("%d-%d-%d", t.Year(), t.Month(), t.Day())
+}
+
+// histogramBuckets returns every bucket overlapping [start, end) in loc, empty, so none are missing from the result.
+// Weeks start on monday, like iso weeks do.
+func histogramBuckets(interval string, start time.Time, end time.Time, loc *time.Location) ([]histogramBucket, error) {
+	t := start.In(loc)
+
+	var next func(t time.Time) time.Time
+	switch interval {
+	case "hour":
+		t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), 0, 0, 0, loc)
+		next = func(t time.Time) time.Time {
+			// wall clock hours, so a bucket is never skipped or repeated around daylight saving changes.
+			return time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, loc)
+		}
+	case "day":
+		t = time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, loc)
+		next = func(t time.Time) time.Time { return t.AddDate(0, 0, 1) }
+	case "week":
+		t = time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, loc)
+		t = t.AddDate(0, 0, -((int(t.Weekday()) + 6) % 7))
+		next = func(t time.Time) time.Time { return t.AddDate(0, 0, 7) }
+	case "month":
+		t = time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, loc)
+		next = func(t time.Time) time.Time { return t.AddDate(0, 1, 0) }
+	default:
+		return nil, fmt.Errorf("interval must be hour, day, week or month")
+	}
+
+	buckets := []histogramBucket{}
+	for ; t.Before(end); t = next(t) {
+		if len(buckets) == maxHistogramBuckets {
+			return nil, fmt.Errorf("too many buckets, at most %d", maxHistogramBuckets)
+		}
+		buckets = append(buckets, histogramBucket{Start: t})
+	}
+
+	return buckets, nil
+}
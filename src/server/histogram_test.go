@@ -0,0 +1,168 @@
+package server
+
+import (
+	"testing"
+	"time"
+)
+
+func TestHistogramBuckets(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skipf("no time zone database: %v", err)
+	}
+	cet := time.FixedZone("CET", 60*60)
+	cest := time.FixedZone("CEST", 2*60*60)
+
+	tests := []struct {
+		name     string
+		interval string
+		start    time.Time
+		end      time.Time
+		loc      *time.Location
+		want     []time.Time
+	}{
+		{
+			name:     "day",
+			interval: "day",
+			start:    time.Date(2022, 3, 1, 10, 0, 0, 0, time.UTC),
+			end:      time.Date(2022, 3, 3, 0, 0, 0, 0, time.UTC),
+			loc:      time.UTC,
+			want: []time.Time{
+				time.Date(2022, 3, 1, 0, 0, 0, 0, time.UTC),
+				time.Date(2022, 3, 2, 0, 0, 0, 0, time.UTC),
+			},
+		},
+		{
+			name:     "day in the time zone",
+			interval: "day",
+			start:    time.Date(2022, 3, 1, 23, 30, 0, 0, time.UTC),
+			end:      time.Date(2022, 3, 2, 23, 0, 0, 0, time.UTC),
+			loc:      berlin,
+			want: []time.Time{
+				time.Date(2022, 3, 2, 0, 0, 0, 0, cet),
+			},
+		},
+		{
+			name:     "week starts on monday",
+			interval: "week",
+			start:    time.Date(2022, 3, 2, 0, 0, 0, 0, time.UTC),
+			end:      time.Date(2022, 3, 8, 0, 0, 0, 0, time.UTC),
+			loc:      time.UTC,
+			want: []time.Time{
+				time.Date(2022, 2, 28, 0, 0, 0, 0, time.UTC),
+				time.Date(2022, 3, 7, 0, 0, 0, 0, time.UTC),
+			},
+		},
+		{
+			name:     "week on a sunday",
+			interval: "week",
+			start:    time.Date(2022, 3, 6, 12, 0, 0, 0, time.UTC),
+			end:      time.Date(2022, 3, 7, 0, 0, 0, 0, time.UTC),
+			loc:      time.UTC,
+			want: []time.Time{
+				time.Date(2022, 2, 28, 0, 0, 0, 0, time.UTC),
+			},
+		},
+		{
+			name:     "month",
+			interval: "month",
+			start:    time.Date(2022, 1, 15, 0, 0, 0, 0, time.UTC),
+			end:      time.Date(2022, 3, 1, 0, 0, 0, 0, time.UTC),
+			loc:      time.UTC,
+			want: []time.Time{
+				time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC),
+				time.Date(2022, 2, 1, 0, 0, 0, 0, time.UTC),
+			},
+		},
+		{
+			name:     "hour when clocks go forward",
+			interval: "hour",
+			start:    time.Date(2022, 3, 27, 0, 0, 0, 0, cet),
+			end:      time.Date(2022, 3, 27, 4, 0, 0, 0, cest),
+			loc:      berlin,
+			want: []time.Time{
+				time.Date(2022, 3, 27, 0, 0, 0, 0, cet),
+				time.Date(2022, 3, 27, 1, 0, 0, 0, cet),
+				time.Date(2022, 3, 27, 3, 0, 0, 0, cest),
+			},
+		},
+		{
+			name:     "day when clocks go back",
+			interval: "day",
+			start:    time.Date(2022, 10, 30, 0, 0, 0, 0, cest),
+			end:      time.Date(2022, 11, 1, 0, 0, 0, 0, cet),
+			loc:      berlin,
+			want: []time.Time{
+				time.Date(2022, 10, 30, 0, 0, 0, 0, cest),
+				time.Date(2022, 10, 31, 0, 0, 0, 0, cet),
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buckets, err := histogramBuckets(tt.interval, tt.start, tt.end, tt.loc)
+			if err != nil {
+				t.Fatalf("histogramBuckets() err = %v", err)
+			}
+			if len(buckets) != len(tt.want) {
+				t.Fatalf("histogramBuckets() = %d buckets, want %d", len(buckets), len(tt.want))
+			}
+			for i, b := range buckets {
+				if !b.Start.Equal(tt.want[i]) {
+					t.Errorf("bucket %d starts %v, want %v", i, b.Start, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestHistogramBucketsHourWhenClocksGoBack(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skipf("no time zone database: %v", err)
+	}
+
+	// mongo groups both hours starting at 2:00 together, so there is one bucket for them.
+	start := time.Date(2022, 10, 30, 1, 0, 0, 0, time.FixedZone("CEST", 2*60*60))
+	end := time.Date(2022, 10, 30, 4, 0, 0, 0, time.FixedZone("CET", 60*60))
+	buckets, err := histogramBuckets("hour", start, end, berlin)
+	if err != nil {
+		t.Fatalf("histogramBuckets() err = %v", err)
+	}
+
+	hours := []int{}
+	for _, b := range buckets {
+		hours = append(hours, b.Start.In(berlin).Hour())
+	}
+	want := []int{1, 2, 3}
+	if len(hours) != len(want) {
+		t.Fatalf("histogramBuckets() hours = %v, want %v", hours, want)
+	}
+	for i := range want {
+		if hours[i] != want[i] {
+			t.Fatalf("histogramBuckets() hours = %v, want %v", hours, want)
+		}
+	}
+}
+
+func TestHistogramBucketsInvalid(t *testing.T) {
+	start := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		interval string
+		end      time.Time
+	}{
+		{"unknown interval", "minute", start.Add(time.Hour)},
+		{"too many buckets", "hour", start.AddDate(1, 0, 0)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := histogramBuckets(tt.interval, start, tt.end, time.UTC); err == nil {
+				t.Error("histogramBuckets() err = nil")
+			}
+		})
+	}
+}
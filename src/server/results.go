@@ -0,0 +1,233 @@
+package server
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/AdmiralBulldogTv/BulldogTax/src/global"
+	"github.com/AdmiralBulldogTv/BulldogTax/src/mongo"
+	"github.com/AdmiralBulldogTv/BulldogTax/src/structures"
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	defaultResultsLimit = 100
+	maxResultsLimit     = 1000
+)
+
+var errInvalidCursor = fmt.Errorf("invalid cursor")
+
+// userTotal is what a user redeemed in the window of a /tax-results query.
+type userTotal struct {
+	UserID    string    `json:"user_id" bson:"_id"`
+	UserName  string    `json:"user_name" bson:"user_name"`
+	Count     int32     `json:"count" bson:"count"`
+	TotalCost int64     `json:"total_cost" bson:"total_cost"`
+	First     time.Time `json:"first_redeemed_at" bson:"first"`
+	Last      time.Time `json:"last_redeemed_at" bson:"last"`
+}
+
+// userTotalsPipeline groups the redemptions matching filter per user, together with the credits and debits
+// of the tax rules on the broadcasters or rewards of filter for periods starting in its window.
+func userTotalsPipeline(gCtx global.Context, ctx context.Context, filter bson.M) (mongo.Pipeline, error) {
+	rulesFilter := bson.M{}
+	if v, ok := filter["broadcaster_user_id"]; ok {
+		rulesFilter["broadcaster_user_id"] = v
+	}
+	if v, ok := filter["reward_id"]; ok {
+		rulesFilter["reward_ids"] = v
+	}
+
+	cur, err := gCtx.Inst().Mongo.Collection(mongo.CollectionNameTaxRules).Find(ctx, rulesFilter, options.Find().SetProjection(bson.M{"_id": 1}))
+	rules := []structures.TaxRule{}
+	if err == nil {
+		err = cur.All(ctx, &rules)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	ruleIDs := make([]primitive.ObjectID, len(rules))
+	for i, rule := range rules {
+		ruleIDs[i] = rule.ID
+	}
+
+	window := filter["redeemed_at"].(bson.M)
+	adjustmentsFilter := bson.M{
+		"tax_rule_id": bson.M{"$in": ruleIDs},
+		"period_start": bson.M{
+			"$gte": window["$gte"],
+			"$lte": window["$lte"],
+		},
+		"kind": bson.M{"$in": bson.A{structures.AdjustmentKindCredit, structures.AdjustmentKindDebit}},
+	}
+	if v, ok := filter["user_id"]; ok {
+		adjustmentsFilter["user_id"] = v
+	}
+
+	// debits are negated so the sums take them away.
+	sign := bson.M{"$cond": bson.A{bson.M{"$eq": bson.A{"$kind", structures.AdjustmentKindDebit}}, -1, 1}}
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: filter}},
+		{{Key: "$project", Value: bson.M{
+			"user_id":     1,
+			"user_name":   1,
+			"count":       bson.M{"$literal": 1},
+			"cost":        1,
+			"redeemed_at": 1,
+		}}},
+		{{Key: "$unionWith", Value: bson.M{
+			"coll": mongo.CollectionNameAdjustments,
+			"pipeline": mongo.Pipeline{
+				{{Key: "$match", Value: adjustmentsFilter}},
+				{{Key: "$project", Value: bson.M{
+					"user_id": 1,
+					"count":   bson.M{"$multiply": bson.A{"$count", sign}},
+					"cost":    bson.M{"$multiply": bson.A{"$amount", sign}},
+				}}},
+			},
+		}}},
+		// adjustments have no redeemed_at and sort first, so the name is the one of the last redemption.
+		{{Key: "$sort", Value: bson.D{{Key: "redeemed_at", Value: 1}}}},
+		{{Key: "$group", Value: bson.M{
+			"_id":        "$user_id",
+			"user_name":  bson.M{"$last": "$user_name"},
+			"count":      bson.M{"$sum": "$count"},
+			"total_cost": bson.M{"$sum": "$cost"},
+			"first":      bson.M{"$min": "$redeemed_at"},
+			"last":       bson.M{"$max": "$redeemed_at"},
+		}}},
+	}
+
+	// adjustments do not carry the name of the user, they only count for the users whose redemptions have it.
+	if v, ok := filter["user_name"]; ok {
+		pipeline = append(pipeline, bson.D{{Key: "$match", Value: bson.M{"user_name": v}}})
+	}
+
+	return pipeline, nil
+}
+
+// userTotalsSort maps the sort parameter of /tax-results/users to the grouped fields.
+var userTotalsSort = map[string]string{
+	"total_cost": "total_cost",
+	"count":      "count",
+	"first":      "first",
+	"last":       "last",
+	"user_id":    "_id",
+}
+
+// queryList collects the values of a query parameter that is repeated, comma separated, or both.
+func queryList(c *fiber.Ctx, key string) []string {
+	values := []string{}
+	for _, v := range c.Context().QueryArgs().PeekMulti(key) {
+		for _, part := range strings.Split(string(v), ",") {
+			if part = strings.TrimSpace(part); part != "" {
+				values = append(values, part)
+			}
+		}
+	}
+
+	return values
+}
+
+// resultsFilter builds the redeem_rewards filter of the query parameters /tax-results takes,
+// false means they are invalid. Results are scoped to broadcasters, rewards or both.
+func resultsFilter(c *fiber.Ctx) (bson.M, bool) {
+	start := c.Query("start_date")
+	end := c.Query("end_date")
+	if start == "" || end == "" {
+		return nil, false
+	}
+
+	startDate, err := time.Parse(time.RFC3339, start)
+	if err != nil {
+		return nil, false
+	}
+	endDate, err := time.Parse(time.RFC3339, end)
+	if err != nil {
+		return nil, false
+	}
+
+	filter := bson.M{
+		"redeemed_at": bson.M{
+			"$gte": startDate,
+			"$lte": endDate,
+		},
+	}
+
+	fields := map[string]string{
+		"broadcaster_id": "broadcaster_user_id",
+		"reward_id":      "reward_id",
+		"user_id":        "user_id",
+		"user_name":      "user_name",
+	}
+	for param, field := range fields {
+		values := queryList(c, param)
+		switch len(values) {
+		case 0:
+		case 1:
+			filter[field] = values[0]
+		default:
+			filter[field] = bson.M{"$in": values}
+		}
+	}
+
+	if filter["broadcaster_user_id"] == nil && filter["reward_id"] == nil {
+		return nil, false
+	}
+
+	// canceled redemptions were refunded by the broadcaster, so they do not count as paid unless asked for.
+	if c.Query("include_canceled") != "true" {
+		filter["status"] = bson.M{"$ne": structures.RedeemStatusCanceled}
+	}
+
+	return filter, true
+}
+
+// encodeCursor points after ev in redeemed_at, _id order.
+func encodeCursor(ev structures.RedeemEvent) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf("%d:%s", ev.RedeemedAt.UnixNano(), ev.ID.Hex())))
+}
+
+// cursorFilter matches the redemptions after the cursor in the direction of the sort.
+func cursorFilter(cursor string, desc bool) (bson.M, error) {
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, errInvalidCursor
+	}
+
+	parts := strings.SplitN(string(data), ":", 2)
+	if len(parts) != 2 {
+		return nil, errInvalidCursor
+	}
+
+	nanos, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return nil, errInvalidCursor
+	}
+	id, err := primitive.ObjectIDFromHex(parts[1])
+	if err != nil {
+		return nil, errInvalidCursor
+	}
+
+	op := "$gt"
+	if desc {
+		op = "$lt"
+	}
+	t := time.Unix(0, nanos)
+
+	return bson.M{
+		"$or": bson.A{
+			bson.M{"redeemed_at": bson.M{op: t}},
+			bson.M{"redeemed_at": t, "_id": bson.M{op: id}},
+		},
+	}, nil
+}
@@ -0,0 +1,225 @@
+package server
+
+import (
+	"encoding/base64"
+	"io/ioutil"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/AdmiralBulldogTv/BulldogTax/src/configure"
+	"github.com/AdmiralBulldogTv/BulldogTax/src/structures"
+	"github.com/AdmiralBulldogTv/BulldogTax/src/testutil"
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestCursorRoundTrip(t *testing.T) {
+	id := primitive.NewObjectID()
+	tests := []struct {
+		name string
+		at   time.Time
+		desc bool
+		op   string
+	}{
+		{"ascending", time.Date(2022, 3, 1, 12, 30, 0, 0, time.UTC), false, "$gt"},
+		{"descending", time.Date(2022, 3, 1, 12, 30, 0, 0, time.UTC), true, "$lt"},
+		{"nanoseconds", time.Date(2022, 3, 1, 12, 30, 0, 123456789, time.UTC), false, "$gt"},
+		{"other zone", time.Date(2022, 3, 1, 12, 30, 0, 0, time.FixedZone("UTC+2", 2*60*60)), false, "$gt"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cursor := encodeCursor(structures.RedeemEvent{ID: id, RedeemedAt: tt.at})
+
+			filter, err := cursorFilter(cursor, tt.desc)
+			if err != nil {
+				t.Fatalf("cursorFilter() err = %v", err)
+			}
+
+			or, ok := filter["$or"].(bson.A)
+			if !ok || len(or) != 2 {
+				t.Fatalf("cursorFilter() = %v, want an $or of two", filter)
+			}
+
+			after, _ := or[0].(bson.M)["redeemed_at"].(bson.M)[tt.op].(time.Time)
+			if !after.Equal(tt.at) {
+				t.Errorf("redeemed_at %s = %v, want %v", tt.op, after, tt.at)
+			}
+
+			same := or[1].(bson.M)
+			if at, _ := same["redeemed_at"].(time.Time); !at.Equal(tt.at) {
+				t.Errorf("redeemed_at = %v, want %v", at, tt.at)
+			}
+			if got, _ := same["_id"].(bson.M)[tt.op].(primitive.ObjectID); got != id {
+				t.Errorf("_id %s = %v, want %v", tt.op, got, id)
+			}
+		})
+	}
+}
+
+func TestCursorFilterInvalid(t *testing.T) {
+	encode := func(s string) string {
+		return base64.RawURLEncoding.EncodeToString([]byte(s))
+	}
+
+	tests := []struct {
+		name   string
+		cursor string
+	}{
+		{"not base64", "!!!"},
+		{"no separator", encode("1646137800000000000")},
+		{"bad time", encode("yesterday:" + primitive.NewObjectID().Hex())},
+		{"bad id", encode("1646137800000000000:nope")},
+		{"empty", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := cursorFilter(tt.cursor, false); err != errInvalidCursor {
+				t.Errorf("cursorFilter() err = %v, want %v", err, errInvalidCursor)
+			}
+		})
+	}
+}
+
+func TestResults(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+
+	redemption := func(twitchID string) bson.D {
+		return bson.D{{Key: "_id", Value: primitive.NewObjectID()}, {Key: "twitch_id", Value: twitchID}, {Key: "redeemed_at", Value: time.Date(2022, 3, 1, 0, 0, 0, 0, time.UTC)}}
+	}
+	found := mtest.CreateCursorResponse(0, "db.redeem_rewards", mtest.FirstBatch, redemption("a"), redemption("b"))
+
+	const query = "/tax-results?broadcaster_id=1&start_date=2022-03-01T00:00:00Z&end_date=2022-03-02T00:00:00Z"
+	tests := []struct {
+		name  string
+		path  string
+		limit int64
+		array bool
+	}{
+		{"every result in a single array", query, 0, true},
+		{"a page", query + "&limit=1", 2, false},
+	}
+
+	for _, tt := range tests {
+		mt.Run(tt.name, func(mt *mtest.T) {
+			config := &configure.Config{}
+			config.API.AdminKey = "admin"
+			gCtx, _ := testutil.Context(mt, config)
+			mt.AddMockResponses(found)
+
+			app := fiber.New()
+			API(gCtx, app)
+
+			req := httptest.NewRequest("GET", tt.path, nil)
+			req.Header.Set("Authorization", "Bearer admin")
+			resp, err := app.Test(req)
+			if err != nil {
+				mt.Fatalf("request err = %v", err)
+			}
+			if resp.StatusCode != 200 {
+				mt.Fatalf("status = %d, want 200", resp.StatusCode)
+			}
+
+			data, _ := ioutil.ReadAll(resp.Body)
+			if tt.array {
+				results := []structures.RedeemEvent{}
+				if err := json.Unmarshal(data, &results); err != nil || len(results) != 2 {
+					mt.Errorf("body = %s, want both results in an array", data)
+				}
+			} else {
+				page := struct {
+					Data       []structures.RedeemEvent `json:"data"`
+					NextCursor string                   `json:"next_cursor"`
+				}{}
+				if err := json.Unmarshal(data, &page); err != nil || len(page.Data) != 1 || page.NextCursor == "" {
+					mt.Errorf("body = %s, want a page of one with a next cursor", data)
+				}
+			}
+
+			find := mt.GetStartedEvent()
+			if limit, err := find.Command.LookupErr("limit"); tt.limit == 0 && err == nil {
+				mt.Errorf("find limit = %v, want none", limit)
+			} else if tt.limit != 0 && (err != nil || limit.AsInt64() != tt.limit) {
+				mt.Errorf("find limit = %v, want %d", limit, tt.limit)
+			}
+		})
+	}
+}
+
+func TestUserTotals(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+
+	ruleID := primitive.NewObjectID()
+	rules := mtest.CreateCursorResponse(0, "db.tax_rules", mtest.FirstBatch, bson.D{{Key: "_id", Value: ruleID}})
+	totals := mtest.CreateCursorResponse(0, "db.redeem_rewards", mtest.FirstBatch, bson.D{
+		{Key: "_id", Value: "2"},
+		{Key: "count", Value: int32(3)},
+		{Key: "total_cost", Value: int64(300)},
+	})
+
+	const query = "/tax-results/users?broadcaster_id=1&start_date=2022-03-01T00:00:00Z&end_date=2022-03-02T00:00:00Z"
+	tests := []struct {
+		name      string
+		path      string
+		responses []bson.D
+		status    int
+	}{
+		{"totals", query + "&limit=10", []bson.D{rules, totals}, 200},
+		{"limit too high", query + "&limit=1001", nil, 400},
+	}
+
+	for _, tt := range tests {
+		mt.Run(tt.name, func(mt *mtest.T) {
+			config := &configure.Config{}
+			config.API.AdminKey = "admin"
+			gCtx, _ := testutil.Context(mt, config)
+			mt.AddMockResponses(tt.responses...)
+
+			app := fiber.New()
+			API(gCtx, app)
+
+			req := httptest.NewRequest("GET", tt.path, nil)
+			req.Header.Set("Authorization", "Bearer admin")
+			resp, err := app.Test(req)
+			if err != nil {
+				mt.Fatalf("request err = %v", err)
+			}
+			if resp.StatusCode != tt.status {
+				mt.Fatalf("status = %d, want %d", resp.StatusCode, tt.status)
+			}
+			if tt.status != 200 {
+				return
+			}
+
+			find := mt.GetStartedEvent()
+			if broadcaster := find.Command.Lookup("filter", "broadcaster_user_id").StringValue(); broadcaster != "1" {
+				mt.Errorf("rules filter broadcaster_user_id = %q, want 1", broadcaster)
+			}
+
+			aggregate := mt.GetStartedEvent()
+			if disk, ok := aggregate.Command.Lookup("allowDiskUse").BooleanOK(); !disk || !ok {
+				mt.Error("the aggregation cannot use the disk")
+			}
+			union := aggregate.Command.Lookup("pipeline").Array().Index(2).Value().Document().Lookup("$unionWith").Document()
+			if coll := union.Lookup("coll").StringValue(); coll != "adjustments" {
+				mt.Errorf("$unionWith coll = %q, want the adjustments", coll)
+			}
+			match := union.Lookup("pipeline").Array().Index(0).Value().Document().Lookup("$match").Document()
+			if id := match.Lookup("tax_rule_id", "$in").Array().Index(0).Value().ObjectID(); id != ruleID {
+				mt.Errorf("adjustments tax_rule_id $in = %v, want the rules of the broadcaster", id)
+			}
+
+			results := []userTotal{}
+			data, _ := ioutil.ReadAll(resp.Body)
+			if err := json.Unmarshal(data, &results); err != nil || len(results) != 1 || results[0].TotalCost != 300 {
+				mt.Errorf("body = %s, want the totals", data)
+			}
+		})
+	}
+}
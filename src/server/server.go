@@ -4,6 +4,7 @@ import (
 	"time"
 
 	"github.com/AdmiralBulldogTv/BulldogTax/src/global"
+	"github.com/AdmiralBulldogTv/BulldogTax/src/structures"
 	"github.com/AdmiralBulldogTv/BulldogTax/src/utils"
 	"github.com/davecgh/go-spew/spew"
 	"github.com/gofiber/fiber/v2"
@@ -37,6 +38,9 @@ func New(gCtx global.Context) <-chan struct{} {
 	}))
 
 	API(gCtx, app)
+	Events(gCtx, app)
+	Admin(gCtx, app.Group("/admin"))
+	WebSocket(gCtx, app.Group("/ws", allow(gCtx, structures.APIKeyPermissionReadResults, "")))
 	Twitch(gCtx, app)
 
 	app.Use(func(c *fiber.Ctx) error {
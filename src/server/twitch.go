@@ -1,19 +1,17 @@
 package server
 
 import (
-	"context"
-	"crypto/hmac"
-	"crypto/sha256"
-	"encoding/hex"
 	"fmt"
 	"time"
 
 	"go.mongodb.org/mongo-driver/bson"
 
 	"github.com/AdmiralBulldogTv/BulldogTax/src/auth"
+	"github.com/AdmiralBulldogTv/BulldogTax/src/eventsub"
 	"github.com/AdmiralBulldogTv/BulldogTax/src/global"
 	"github.com/AdmiralBulldogTv/BulldogTax/src/mongo"
 	"github.com/AdmiralBulldogTv/BulldogTax/src/structures"
+	"github.com/AdmiralBulldogTv/BulldogTax/src/twitch"
 	"github.com/AdmiralBulldogTv/BulldogTax/src/utils"
 	"github.com/nicklaw5/helix"
 	"github.com/sirupsen/logrus"
@@ -23,19 +21,16 @@ import (
 	jsoniter "github.com/json-iterator/go"
 )
 
-type WebhookCallback struct {
-	Challenge    string                                                 `json:"challenge"`
-	Subscription helix.EventSubSubscription                             `json:"subscription"`
-	Event        helix.EventSubChannelPointsCustomRewardRedemptionEvent `json:"event"`
-}
-
 var json = jsoniter.ConfigCompatibleWithStandardLibrary
 
 func Twitch(gCtx global.Context, app fiber.Router) {
+	dispatcher := eventsub.New(gCtx)
+
 	app.Get("/login", func(c *fiber.Ctx) error {
 		api, err := helix.NewClient(&helix.Options{
 			ClientID:     gCtx.Config().Twitch.ClientID,
 			ClientSecret: gCtx.Config().Twitch.ClientSecret,
+			APIBaseURL:   twitch.APIURL(gCtx),
 			RedirectURI:  gCtx.Config().Twitch.RedirectURI,
 		})
 		if err != nil {
@@ -61,7 +56,7 @@ func Twitch(gCtx global.Context, app fiber.Router) {
 
 		authURL := api.GetAuthorizationURL(&helix.AuthorizationURLParams{
 			ResponseType: "code",
-			Scopes:       []string{"channel:read:redemptions"},
+			Scopes:       []string{"channel:read:redemptions", "channel:manage:redemptions", "moderation:read", "channel:read:vips", "channel:read:subscriptions"},
 			State:        csrfToken,
 		})
 
@@ -86,6 +81,7 @@ func Twitch(gCtx global.Context, app fiber.Router) {
 		api, err := helix.NewClient(&helix.Options{
 			ClientID:       gCtx.Config().Twitch.ClientID,
 			ClientSecret:   gCtx.Config().Twitch.ClientSecret,
+			APIBaseURL:     twitch.APIURL(gCtx),
 			RedirectURI:    gCtx.Config().Twitch.RedirectURI,
 			AppAccessToken: tkn,
 		})
@@ -135,46 +131,20 @@ func Twitch(gCtx global.Context, app fiber.Router) {
 
 		user := users.Data.Users[0]
 
-		wh := structures.WebHook{}
-
-		res := gCtx.Inst().Mongo.Collection(mongo.CollectionNameWebhooks).FindOneAndDelete(c.Context(), bson.M{
-			"user_id": user.ID,
-		})
+		api.SetUserAccessToken("")
 
-		err = res.Err()
-		if err == nil {
-			err = res.Decode(&wh)
+		// the tokens are stored first, failing to store them must not leave the broadcaster without subscriptions.
+		if err := gCtx.Inst().Tokens.Save(c.Context(), user.ID, tknResp.Data); err != nil {
+			logrus.Errorf("tokens, err=%v", err)
+			return err
 		}
 
-		if err != nil && err != mongo.ErrNoDocuments {
-			logrus.Errorf("mongo, err=%v", err)
+		if err := eventsub.Unsubscribe(gCtx, c.Context(), api, user.ID); err != nil {
+			logrus.Errorf("unsubscribe, err=%v", err)
 			return err
-		} else if err == nil {
-			_, err = api.RemoveEventSubSubscription(wh.TwitchID)
-			if err != nil {
-				logrus.Errorf("api err=%v", err)
-				return err
-			}
 		}
 
-		api.SetUserAccessToken("")
-
-		resp, err := api.CreateEventSubSubscription(&helix.EventSubSubscription{
-			Type:    "channel.channel_points_custom_reward_redemption.add",
-			Version: "1",
-			Condition: helix.EventSubCondition{
-				BroadcasterUserID: user.ID,
-			},
-			Transport: helix.EventSubTransport{
-				Method:   "webhook",
-				Callback: fmt.Sprintf("%s/webhook/%s", gCtx.Config().Frontend.WebsiteURL, user.ID),
-				Secret:   gCtx.Config().Twitch.WebhookSecret,
-			},
-		})
-		if err != nil || resp.Error != "" || len(resp.Data.EventSubSubscriptions) == 0 {
-			if err == nil {
-				err = fmt.Errorf("%s %s %d", resp.Error, resp.ErrorMessage, resp.ErrorStatus)
-			}
+		if err := eventsub.Subscribe(gCtx, c.Context(), api, user.ID, tknResp.Data.AccessToken); err != nil {
 			logrus.Errorf("api, err=%v", err)
 			return c.Status(400).JSON(&fiber.Map{
 				"status":  400,
@@ -183,12 +153,7 @@ func Twitch(gCtx global.Context, app fiber.Router) {
 			})
 		}
 
-		_, err = gCtx.Inst().Mongo.Collection(mongo.CollectionNameWebhooks).InsertOne(c.Context(), structures.WebHook{
-			TwitchID:  resp.Data.EventSubSubscriptions[0].ID,
-			UserID:    user.ID,
-			CreatedAt: time.Now(),
-		})
-		if err != nil {
+		if err := eventsub.RegisterBroadcaster(gCtx, c.Context(), user); err != nil {
 			logrus.Errorf("mongo, err=%v", err)
 			return err
 		}
@@ -199,21 +164,21 @@ func Twitch(gCtx global.Context, app fiber.Router) {
 	app.Post("/webhook/:id", func(c *fiber.Ctx) error {
 		streamerID := c.Params("id")
 
-		wh := &structures.WebHook{}
-		res := gCtx.Inst().Mongo.Collection(mongo.CollectionNameWebhooks).FindOne(c.Context(), bson.M{
+		cur, err := gCtx.Inst().Mongo.Collection(mongo.CollectionNameWebhooks).Find(c.Context(), bson.M{
 			"user_id": streamerID,
 		})
-		err := res.Err()
+
+		whs := []structures.WebHook{}
 		if err == nil {
-			err = res.Decode(wh)
+			err = cur.All(c.Context(), &whs)
 		}
 		if err != nil {
-			if err == mongo.ErrNoDocuments {
-				return c.SendStatus(404)
-			}
 			logrus.Errorf("mongo, err=%v", err)
 			return err
 		}
+		if len(whs) == 0 {
+			return c.SendStatus(404)
+		}
 
 		t, err := time.Parse(time.RFC3339, c.Get("Twitch-Eventsub-Message-Timestamp"))
 		if err != nil || t.Before(time.Now().Add(-10*time.Minute)) {
@@ -228,74 +193,56 @@ func Twitch(gCtx global.Context, app fiber.Router) {
 
 		body := c.Body()
 
-		hmacMessage := fmt.Sprintf("%s%s%s", msgID, c.Get("Twitch-Eventsub-Message-Timestamp"), body)
-
-		h := hmac.New(sha256.New, utils.S2B(gCtx.Config().Twitch.WebhookSecret))
-
-		// Write Data to it
-		_, err = h.Write(utils.S2B(hmacMessage))
+		msg, err := eventsub.ParseWebhook(func(key string) string {
+			return c.Get(key)
+		}, body)
 		if err != nil {
-			logrus.Errorf("hmac, err=%v", err)
-			return c.SendStatus(500)
+			return c.SendStatus(400)
 		}
 
-		// Get result and encode as hexadecimal string
-		sha := hex.EncodeToString(h.Sum(nil))
+		// the delivery has to be for one of the subscriptions we created for this broadcaster,
+		// otherwise a broadcaster could feed events of another one through their own secret.
+		eventBroadcasterID, err := msg.EventBroadcasterUserID()
+		if err != nil {
+			return c.SendStatus(400)
+		}
+		if msg.Subscription.Condition.BroadcasterUserID != streamerID || (eventBroadcasterID != "" && eventBroadcasterID != streamerID) {
+			return c.SendStatus(403)
+		}
 
-		if c.Get("Twitch-Eventsub-Message-Signature") != fmt.Sprintf("sha256=%s", sha) {
+		whs = eventsub.MatchWebhooks(whs, msg)
+		if len(whs) == 0 {
 			return c.SendStatus(403)
 		}
 
-		newKey := fmt.Sprintf("twitch:events:%s:%s:%s", c.Params("type"), c.Params("id"), msgID)
-		set, err := gCtx.Inst().Redis.SetNX(c.Context(), newKey, "1", time.Hour)
+		ok, err := eventsub.VerifyWebhook(gCtx, whs, msgID, c.Get("Twitch-Eventsub-Message-Timestamp"), body, c.Get("Twitch-Eventsub-Message-Signature"))
 		if err != nil {
-			logrus.Errorf("redis err=%s", err)
+			logrus.Errorf("verify, err=%v", err)
 			return c.SendStatus(500)
 		}
-		if !set {
-			logrus.Errorf("duplicate event key=%s", newKey)
-			return c.SendStatus(200)
-		}
-
-		cleanUp := func(statusCode int, resp string) error {
-			if statusCode != 200 {
-				if err := gCtx.Inst().Redis.Del(context.Background(), newKey); err != nil {
-					logrus.Errorf("redis, err=%e", err)
-				}
-			}
-			if resp == "" {
-				return c.SendStatus(statusCode)
-			}
-			return c.Status(statusCode).SendString(resp)
+		if !ok {
+			return c.SendStatus(403)
 		}
 
-		callback := WebhookCallback{}
-		if err := json.Unmarshal(body, callback); err != nil {
-			return cleanUp(400, "")
-		}
+		headers := map[string]string{}
+		c.Request().Header.VisitAll(func(key, value []byte) {
+			headers[string(key)] = string(value)
+		})
 
-		if callback.Subscription.Status == "authorization_revoked" {
-			return cleanUp(200, "")
-		}
+		resp, err := dispatcher.Process(c.Context(), msg, eventsub.TransportWebhook, headers, body)
+		if err != nil {
+			if err == eventsub.ErrInvalidMessage || err == eventsub.ErrUnknownMessageType {
+				return c.SendStatus(400)
+			}
 
-		if callback.Challenge != "" {
-			return cleanUp(200, callback.Challenge)
+			logrus.Errorf("eventsub, type=%s err=%v", msg.Subscription.Type, err)
+			return c.SendStatus(500)
 		}
 
-		_, err = gCtx.Inst().Mongo.Collection(mongo.CollectionNameRedeemRewards).InsertOne(context.Background(), structures.RedeemEvent{
-			TwitchID:   callback.Event.ID,
-			RewardID:   callback.Event.Reward.ID,
-			RewardName: callback.Event.Reward.Title,
-			UserID:     callback.Event.UserID,
-			UserName:   callback.Event.UserName,
-			Cost:       int32(callback.Event.Reward.Cost),
-			RedeemedAt: callback.Event.RedeemedAt.Time,
-		})
-		if err != nil {
-			logrus.Errorf("mongo, err=%v", err)
-			return cleanUp(500, "")
+		if resp == "" {
+			return c.SendStatus(200)
 		}
 
-		return cleanUp(200, "")
+		return c.Status(200).SendString(resp)
 	})
 }
@@ -0,0 +1,123 @@
+package server
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/AdmiralBulldogTv/BulldogTax/src/configure"
+	"github.com/AdmiralBulldogTv/BulldogTax/src/encryption"
+	"github.com/AdmiralBulldogTv/BulldogTax/src/testutil"
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestWebhook(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+
+	key := make([]byte, 32)
+	secret, err := encryption.Encrypt(key, "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	webhooks := mtest.CreateCursorResponse(0, "db.webhooks", mtest.FirstBatch, bson.D{
+		{Key: "twitch_id", Value: "sub"},
+		{Key: "user_id", Value: "1"},
+		{Key: "type", Value: "channel.channel_points_custom_reward_redemption.add"},
+		{Key: "secret", Value: secret},
+	})
+	// the subscription of a webhook is verified before its id is stored.
+	pending := mtest.CreateCursorResponse(0, "db.webhooks", mtest.FirstBatch, bson.D{
+		{Key: "twitch_id", Value: ""},
+		{Key: "user_id", Value: "1"},
+		{Key: "type", Value: "channel.channel_points_custom_reward_redemption.add"},
+		{Key: "secret", Value: secret},
+	})
+	oldSecret, err := encryption.Encrypt(key, "old-secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a subscription replacing the one of a webhook is verified with its next secret.
+	replacing := mtest.CreateCursorResponse(0, "db.webhooks", mtest.FirstBatch, bson.D{
+		{Key: "twitch_id", Value: "sub"},
+		{Key: "user_id", Value: "1"},
+		{Key: "type", Value: "channel.channel_points_custom_reward_redemption.add"},
+		{Key: "secret", Value: oldSecret},
+		{Key: "next_secret", Value: secret},
+	})
+	stored := mtest.CreateSuccessResponse(bson.E{Key: "value", Value: bson.D{
+		{Key: "_id", Value: primitive.NewObjectID()},
+		{Key: "message_id", Value: "message"},
+	}})
+
+	body := func(subscriptionID string, broadcasterID string, eventBroadcasterID string) string {
+		return fmt.Sprintf(`{"challenge":"challenge","subscription":{"id":%q,"type":"channel.channel_points_custom_reward_redemption.add","condition":{"broadcaster_user_id":%q}},"event":{"broadcaster_user_id":%q}}`, subscriptionID, broadcasterID, eventBroadcasterID)
+	}
+
+	tests := []struct {
+		name      string
+		msgType   string
+		body      string
+		secret    string
+		responses []bson.D
+		status    int
+	}{
+		{"delivered", "webhook_callback_verification", body("sub", "1", "1"), "secret", []bson.D{webhooks, stored, mtest.CreateSuccessResponse()}, 200},
+		{"wrong signature", "webhook_callback_verification", body("sub", "1", "1"), "other-secret", []bson.D{webhooks}, 403},
+		{"unknown subscription", "webhook_callback_verification", body("other-sub", "1", "1"), "secret", []bson.D{webhooks}, 403},
+		{"subscription of another broadcaster", "webhook_callback_verification", body("sub", "2", "1"), "secret", []bson.D{webhooks}, 403},
+		{"event of another broadcaster", "notification", body("sub", "1", "2"), "secret", []bson.D{webhooks}, 403},
+		{"verification of a pending subscription", "webhook_callback_verification", body("new-sub", "1", "1"), "secret", []bson.D{pending, stored, mtest.CreateSuccessResponse()}, 200},
+		{"verification of a replacing subscription", "webhook_callback_verification", body("new-sub", "1", "1"), "secret", []bson.D{replacing, stored, mtest.CreateSuccessResponse()}, 200},
+		{"notification of a pending subscription", "notification", body("new-sub", "1", "1"), "secret", []bson.D{pending}, 403},
+	}
+
+	for _, tt := range tests {
+		mt.Run(tt.name, func(mt *mtest.T) {
+			config := &configure.Config{}
+			config.Encryption.Key = base64.StdEncoding.EncodeToString(key)
+			gCtx, _ := testutil.Context(mt, config)
+			mt.AddMockResponses(tt.responses...)
+
+			app := fiber.New()
+			Twitch(gCtx, app)
+
+			timestamp := time.Now().UTC().Format(time.RFC3339)
+			h := hmac.New(sha256.New, []byte(tt.secret))
+			h.Write([]byte("message" + timestamp + tt.body))
+
+			req := httptest.NewRequest("POST", "/webhook/1", bytes.NewReader([]byte(tt.body)))
+			req.Header.Set("Twitch-Eventsub-Message-Id", "message")
+			req.Header.Set("Twitch-Eventsub-Message-Type", tt.msgType)
+			req.Header.Set("Twitch-Eventsub-Message-Timestamp", timestamp)
+			req.Header.Set("Twitch-Eventsub-Message-Signature", "sha256="+hex.EncodeToString(h.Sum(nil)))
+
+			resp, err := app.Test(req)
+			if err != nil {
+				mt.Fatalf("request err = %v", err)
+			}
+			if resp.StatusCode != tt.status {
+				mt.Fatalf("status = %d, want %d", resp.StatusCode, tt.status)
+			}
+
+			if tt.status == 200 {
+				data, _ := ioutil.ReadAll(resp.Body)
+				if string(data) != "challenge" {
+					mt.Errorf("body = %q, want the challenge", data)
+				}
+			} else if len(mt.GetAllStartedEvents()) != 1 {
+				mt.Error("a rejected delivery was stored")
+			}
+		})
+	}
+}
@@ -0,0 +1,436 @@
+package server
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/AdmiralBulldogTv/BulldogTax/src/apikeys"
+	"github.com/AdmiralBulldogTv/BulldogTax/src/feed"
+	"github.com/AdmiralBulldogTv/BulldogTax/src/global"
+	"github.com/AdmiralBulldogTv/BulldogTax/src/ledger"
+	"github.com/AdmiralBulldogTv/BulldogTax/src/mongo"
+	"github.com/AdmiralBulldogTv/BulldogTax/src/structures"
+	"github.com/AdmiralBulldogTv/BulldogTax/src/taxes"
+	"github.com/fasthttp/websocket"
+	"github.com/gofiber/fiber/v2"
+	"github.com/sirupsen/logrus"
+	"github.com/valyala/fasthttp"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	wsPingInterval = time.Second * 30
+	// wsPongTimeout is how long a client can go without answering a ping before it is dropped.
+	wsPongTimeout  = time.Minute
+	wsWriteTimeout = time.Second * 10
+	// wsQueueSize is how many messages a client can fall behind by, one that falls further is disconnected.
+	wsQueueSize         = 256
+	wsMaxMessageSize    = 4096
+	wsMaxSubscriptions  = 32
+	wsDefaultLeaderSize = 10
+	wsMaxLeaderSize     = 100
+)
+
+const (
+	wsTopicRedemptions = "redemptions"
+	wsTopicCompliance  = "compliance"
+	wsTopicLeaderboard = "leaderboard"
+)
+
+// wsRequest is a message of a client, subscribing to a topic or unsubscribing from it.
+type wsRequest struct {
+	Type string `json:"type"`
+	// ID is the client's name for the subscription, it is on every message sent for it.
+	ID    string `json:"id"`
+	Topic string `json:"topic"`
+
+	BroadcasterID string   `json:"broadcaster_id"`
+	RewardIDs     []string `json:"reward_ids"`
+	RuleID        string   `json:"rule_id"`
+	Limit         int      `json:"limit"`
+	// LastEventID resumes a redemptions subscription after the redemption with the id.
+	LastEventID string `json:"last_event_id"`
+}
+
+type wsMessage struct {
+	Type    string      `json:"type"`
+	ID      string      `json:"id,omitempty"`
+	Topic   string      `json:"topic,omitempty"`
+	Data    interface{} `json:"data,omitempty"`
+	Message string      `json:"message,omitempty"`
+}
+
+type wsSubscription struct {
+	topic         string
+	filter        feed.Filter
+	broadcasterID string
+	ruleID        primitive.ObjectID
+	// after is where a resume starts, the redemptions it read back are not sent again while their live copies
+	// can still arrive.
+	after         primitive.ObjectID
+	replayed      feed.Replayed
+	replayedUntil time.Time
+}
+
+// match reports whether the published value is for the subscription.
+func (s *wsSubscription) match(v interface{}) bool {
+	switch v := v.(type) {
+	case feed.Event:
+		if s.replayed != nil && time.Now().After(s.replayedUntil) {
+			s.replayed = nil
+		}
+		return s.topic == wsTopicRedemptions && s.filter.Match(v) && !s.replayed.Skip(v)
+	case feed.Compliance:
+		return s.topic == wsTopicCompliance && v.RuleID == s.ruleID
+	case structures.Balance:
+		return s.topic == wsTopicLeaderboard && v.BroadcasterUserID == s.broadcasterID
+	}
+
+	return false
+}
+
+// wsHub relays what is published on redis to the clients connected to this instance. It never waits on a client,
+// each has a queue of its own and is disconnected when it fills up.
+type wsHub struct {
+	mtx     sync.Mutex
+	clients map[*wsClient]struct{}
+}
+
+func newWsHub(gCtx global.Context) *wsHub {
+	h := &wsHub{
+		clients: map[*wsClient]struct{}{},
+	}
+
+	redemptions := make(chan string, 1024)
+	compliance := make(chan string, 1024)
+	balances := make(chan string, 1024)
+	gCtx.Inst().Redis.Subscribe(gCtx, redemptions, feed.ChannelRedemptions)
+	gCtx.Inst().Redis.Subscribe(gCtx, compliance, feed.ChannelCompliance)
+	gCtx.Inst().Redis.Subscribe(gCtx, balances, feed.ChannelBalances)
+
+	go func() {
+		for {
+			var (
+				v   interface{}
+				err error
+			)
+			select {
+			case <-gCtx.Done():
+				return
+			case payload := <-redemptions:
+				e := feed.Event{}
+				err = feed.Parse(payload, &e)
+				v = e
+			case payload := <-compliance:
+				c := feed.Compliance{}
+				err = feed.Parse(payload, &c)
+				v = c
+			case payload := <-balances:
+				b := structures.Balance{}
+				err = feed.Parse(payload, &b)
+				v = b
+			}
+			if err != nil {
+				logrus.Errorf("websocket, err=%v", err)
+				continue
+			}
+
+			h.mtx.Lock()
+			for cl := range h.clients {
+				cl.push(v)
+			}
+			h.mtx.Unlock()
+		}
+	}()
+
+	return h
+}
+
+func (h *wsHub) add(cl *wsClient) {
+	h.mtx.Lock()
+	h.clients[cl] = struct{}{}
+	h.mtx.Unlock()
+}
+
+func (h *wsHub) remove(cl *wsClient) {
+	h.mtx.Lock()
+	delete(h.clients, cl)
+	h.mtx.Unlock()
+}
+
+type wsClient struct {
+	gCtx     global.Context
+	key      structures.APIKey
+	conn     *websocket.Conn
+	events   chan interface{}
+	requests chan wsRequest
+	// slow is closed when the client fell too far behind.
+	slow     chan struct{}
+	slowOnce sync.Once
+	// subs is only used by the goroutine writing to the client.
+	subs map[string]*wsSubscription
+}
+
+// push queues the value for the client without waiting.
+func (cl *wsClient) push(v interface{}) {
+	select {
+	case cl.events <- v:
+	default:
+		cl.slowOnce.Do(func() {
+			close(cl.slow)
+		})
+	}
+}
+
+func (cl *wsClient) send(msg wsMessage) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	_ = cl.conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+	return cl.conn.WriteMessage(websocket.TextMessage, data)
+}
+
+func (cl *wsClient) close(code int, text string) {
+	_ = cl.conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, text), time.Now().Add(wsWriteTimeout))
+}
+
+// read passes the requests of the client on until it goes away.
+func (cl *wsClient) read(ctx context.Context, cancel context.CancelFunc) {
+	defer cancel()
+
+	cl.conn.SetReadLimit(wsMaxMessageSize)
+	_ = cl.conn.SetReadDeadline(time.Now().Add(wsPongTimeout))
+	cl.conn.SetPongHandler(func(string) error {
+		return cl.conn.SetReadDeadline(time.Now().Add(wsPongTimeout))
+	})
+
+	for {
+		_, data, err := cl.conn.ReadMessage()
+		if err != nil {
+			return
+		}
+
+		req := wsRequest{}
+		if err := json.Unmarshal(data, &req); err != nil {
+			req = wsRequest{Type: "invalid"}
+		}
+
+		select {
+		case cl.requests <- req:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// run writes to the client, everything sent to it goes through here.
+func (cl *wsClient) run(ctx context.Context) {
+	ticker := time.NewTicker(wsPingInterval)
+	defer ticker.Stop()
+
+	for {
+		var err error
+		select {
+		case <-ctx.Done():
+			if cl.gCtx.Err() != nil {
+				cl.close(websocket.CloseGoingAway, "shutting down")
+			}
+			return
+		case <-cl.slow:
+			cl.close(websocket.CloseTryAgainLater, "client is too slow")
+			return
+		case <-ticker.C:
+			err = cl.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(wsWriteTimeout))
+		case req := <-cl.requests:
+			err = cl.handle(ctx, req)
+		case v := <-cl.events:
+			for id, sub := range cl.subs {
+				if !sub.match(v) {
+					continue
+				}
+				if err = cl.send(wsMessage{Type: "event", ID: id, Topic: sub.topic, Data: v}); err != nil {
+					break
+				}
+			}
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// handle answers a request of the client, an error ends the connection.
+func (cl *wsClient) handle(ctx context.Context, req wsRequest) error {
+	reject := func(message string) error {
+		return cl.send(wsMessage{Type: "error", ID: req.ID, Topic: req.Topic, Message: message})
+	}
+
+	switch req.Type {
+	case "subscribe":
+	case "unsubscribe":
+		if _, ok := cl.subs[req.ID]; !ok {
+			return reject("unknown subscription")
+		}
+		delete(cl.subs, req.ID)
+		return cl.send(wsMessage{Type: "unsubscribed", ID: req.ID})
+	default:
+		return reject("unknown request")
+	}
+
+	if req.ID == "" {
+		return reject("id is required")
+	}
+	if _, ok := cl.subs[req.ID]; ok {
+		return reject("id is in use")
+	}
+	if len(cl.subs) >= wsMaxSubscriptions {
+		return reject("too many subscriptions")
+	}
+
+	// keys scoped to a broadcaster only subscribe to theirs.
+	if req.BroadcasterID == "" {
+		req.BroadcasterID = cl.key.BroadcasterUserID
+	} else if !apikeys.Allows(cl.key, req.BroadcasterID) {
+		return reject("forbidden")
+	}
+
+	sub := &wsSubscription{
+		topic:         req.Topic,
+		broadcasterID: req.BroadcasterID,
+	}
+
+	var snapshot interface{}
+	switch req.Topic {
+	case wsTopicRedemptions:
+		if req.BroadcasterID != "" {
+			sub.filter.BroadcasterIDs = []string{req.BroadcasterID}
+		}
+		sub.filter.RewardIDs = req.RewardIDs
+		if len(sub.filter.BroadcasterIDs) == 0 && len(sub.filter.RewardIDs) == 0 {
+			return reject("broadcaster_id or reward_ids is required")
+		}
+		if req.LastEventID != "" {
+			after, err := primitive.ObjectIDFromHex(req.LastEventID)
+			if err != nil {
+				return reject("invalid last_event_id")
+			}
+			sub.after = after
+		}
+	case wsTopicCompliance:
+		rule, err := taxes.GetRule(cl.gCtx, ctx, req.RuleID)
+		if err != nil {
+			if err == mongo.ErrNoDocuments {
+				return reject("unknown rule")
+			}
+			logrus.Errorf("mongo, err=%v", err)
+			return reject("internal error")
+		}
+		if !apikeys.Allows(cl.key, rule.BroadcasterUserID) {
+			return reject("forbidden")
+		}
+		sub.ruleID = rule.ID
+
+		// where every user stands in the current period, changes follow.
+		now := time.Now()
+		periods, err := taxes.Evaluate(cl.gCtx, ctx, rule, now, now.Add(time.Nanosecond), nil)
+		if err != nil {
+			if err == taxes.ErrNoBroadcaster {
+				return reject(err.Error())
+			}
+			logrus.Errorf("taxes, err=%v", err)
+			return reject("internal error")
+		}
+		snapshot = periods
+	case wsTopicLeaderboard:
+		if req.BroadcasterID == "" {
+			return reject("broadcaster_id is required")
+		}
+		limit := req.Limit
+		if limit <= 0 {
+			limit = wsDefaultLeaderSize
+		} else if limit > wsMaxLeaderSize {
+			limit = wsMaxLeaderSize
+		}
+
+		balances, err := ledger.Balances(cl.gCtx, ctx, req.BroadcasterID, "")
+		if err != nil {
+			logrus.Errorf("mongo, err=%v", err)
+			return reject("internal error")
+		}
+		if len(balances) > limit {
+			balances = balances[:limit]
+		}
+		snapshot = balances
+	default:
+		return reject("unknown topic")
+	}
+
+	cl.subs[req.ID] = sub
+	if err := cl.send(wsMessage{Type: "subscribed", ID: req.ID, Topic: sub.topic}); err != nil {
+		return err
+	}
+	if snapshot != nil {
+		return cl.send(wsMessage{Type: "snapshot", ID: req.ID, Topic: sub.topic, Data: snapshot})
+	}
+
+	// the redemptions stored since the client last saw one, new ones queue up meanwhile and are skipped when sent already.
+	if sub.topic == wsTopicRedemptions && !sub.after.IsZero() {
+		sub.replayed = feed.Replayed{}
+		defer func() {
+			sub.replayedUntil = time.Now().Add(feed.ReplayOverlap)
+		}()
+
+		return feed.Since(cl.gCtx, ctx, sub.filter, sub.after, func(e feed.Event) error {
+			sub.replayed.Add(e.ID)
+			return cl.send(wsMessage{Type: "event", ID: req.ID, Topic: sub.topic, Data: e})
+		})
+	}
+
+	return nil
+}
+
+func WebSocket(gCtx global.Context, app fiber.Router) {
+	hub := newWsHub(gCtx)
+
+	// clients authenticate with a key rather than cookies, so any origin can connect.
+	upgrader := websocket.FastHTTPUpgrader{
+		HandshakeTimeout: time.Second * 10,
+		CheckOrigin: func(*fasthttp.RequestCtx) bool {
+			return true
+		},
+	}
+
+	app.Get("/", func(c *fiber.Ctx) error {
+		if !websocket.FastHTTPIsWebSocketUpgrade(c.Context()) {
+			return c.SendStatus(426)
+		}
+
+		key, _ := requestKey(c)
+
+		// the connection outlives the request, c must not be used by the handler.
+		return upgrader.Upgrade(c.Context(), func(conn *websocket.Conn) {
+			defer conn.Close()
+
+			cl := &wsClient{
+				gCtx:     gCtx,
+				key:      key,
+				conn:     conn,
+				events:   make(chan interface{}, wsQueueSize),
+				requests: make(chan wsRequest),
+				slow:     make(chan struct{}),
+				subs:     map[string]*wsSubscription{},
+			}
+			hub.add(cl)
+			defer hub.remove(cl)
+
+			ctx, cancel := context.WithCancel(gCtx)
+			defer cancel()
+
+			go cl.read(ctx, cancel)
+			cl.run(ctx)
+		})
+	})
+}
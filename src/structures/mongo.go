@@ -7,19 +7,244 @@ import (
 )
 
 type WebHook struct {
-	ID        primitive.ObjectID `json:"id" bson:"_id,omitempty"`
-	TwitchID  string             `json:"twitch_id" bson:"twitch_id"`
-	UserID    string             `json:"user_id" bson:"user_id"`
-	CreatedAt time.Time          `json:"created_at" bson:"created_at"`
+	ID         primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	TwitchID   string             `json:"twitch_id" bson:"twitch_id"`
+	UserID     string             `json:"user_id" bson:"user_id"`
+	Type       string             `json:"type" bson:"type"`
+	Transport  string             `json:"transport" bson:"transport"`
+	Status     string             `json:"status" bson:"status"`
+	SecretID   string             `json:"secret_id" bson:"secret_id"`
+	Secret     string             `json:"-" bson:"secret,omitempty"`
+	NextSecret string             `json:"-" bson:"next_secret,omitempty"`
+	CreatedAt  time.Time          `json:"created_at" bson:"created_at"`
+	CheckedAt  time.Time          `json:"checked_at" bson:"checked_at"`
+}
+
+type BroadcasterStatus string
+
+const (
+	BroadcasterStatusActive  BroadcasterStatus = "active"
+	BroadcasterStatusRevoked BroadcasterStatus = "revoked"
+	// BroadcasterStatusNeedsRelogin is set when their refresh token stopped working.
+	BroadcasterStatusNeedsRelogin BroadcasterStatus = "needs_relogin"
+)
+
+type Broadcaster struct {
+	ID          primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	UserID      string             `json:"user_id" bson:"user_id"`
+	Login       string             `json:"login" bson:"login"`
+	DisplayName string             `json:"display_name" bson:"display_name"`
+	Status      BroadcasterStatus  `json:"status" bson:"status"`
+	CreatedAt   time.Time          `json:"created_at" bson:"created_at"`
+	UpdatedAt   time.Time          `json:"updated_at" bson:"updated_at"`
+	RevokedAt   time.Time          `json:"revoked_at,omitempty" bson:"revoked_at,omitempty"`
 }
 
+type UserToken struct {
+	ID           primitive.ObjectID `json:"-" bson:"_id,omitempty"`
+	UserID       string             `json:"user_id" bson:"user_id"`
+	AccessToken  string             `json:"-" bson:"access_token"`
+	RefreshToken string             `json:"-" bson:"refresh_token"`
+	Scopes       []string           `json:"scopes" bson:"scopes"`
+	ExpiresAt    time.Time          `json:"expires_at" bson:"expires_at"`
+	UpdatedAt    time.Time          `json:"updated_at" bson:"updated_at"`
+}
+
+type Reward struct {
+	ID                primitive.ObjectID `json:"-" bson:"_id,omitempty"`
+	TwitchID          string             `json:"id" bson:"twitch_id"`
+	BroadcasterUserID string             `json:"broadcaster_user_id" bson:"broadcaster_user_id"`
+	Title             string             `json:"title" bson:"title"`
+	Prompt            string             `json:"prompt" bson:"prompt"`
+	Cost              int32              `json:"cost" bson:"cost"`
+	BackgroundColor   string             `json:"background_color" bson:"background_color"`
+	IsEnabled         bool               `json:"is_enabled" bson:"is_enabled"`
+	IsPaused          bool               `json:"is_paused" bson:"is_paused"`
+	// Manageable rewards were created by us, only their redemptions can be read and updated through helix.
+	Manageable bool      `json:"manageable" bson:"manageable"`
+	CreatedAt  time.Time `json:"created_at" bson:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at" bson:"updated_at"`
+}
+
+type TaxRecurrence string
+
+const (
+	TaxRecurrenceDaily   TaxRecurrence = "daily"
+	TaxRecurrenceWeekly  TaxRecurrence = "weekly"
+	TaxRecurrenceMonthly TaxRecurrence = "monthly"
+)
+
+// TaxRule is a tax users pay by redeeming any of its rewards every period,
+// at least RequiredCount times and for at least RequiredAmount points.
+type TaxRule struct {
+	ID                primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	BroadcasterUserID string             `json:"broadcaster_user_id" bson:"broadcaster_user_id"`
+	Name              string             `json:"name" bson:"name"`
+	RewardIDs         []string           `json:"reward_ids" bson:"reward_ids"`
+	Recurrence        TaxRecurrence      `json:"recurrence" bson:"recurrence"`
+	// TimeZone is the IANA time zone periods start in, weeks start on monday.
+	TimeZone       string    `json:"time_zone" bson:"time_zone"`
+	RequiredCount  int32     `json:"required_count" bson:"required_count"`
+	RequiredAmount int32     `json:"required_amount" bson:"required_amount"`
+	EffectiveFrom  time.Time `json:"effective_from" bson:"effective_from"`
+	EffectiveUntil time.Time `json:"effective_until,omitempty" bson:"effective_until,omitempty"`
+	CreatedAt      time.Time `json:"created_at" bson:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at" bson:"updated_at"`
+}
+
+type AdjustmentKind string
+
+const (
+	// AdjustmentKindExempt excuses the user from the tax of the period.
+	AdjustmentKindExempt AdjustmentKind = "exempt"
+	// AdjustmentKindCredit counts a payment made outside of twitch.
+	AdjustmentKindCredit AdjustmentKind = "credit"
+	// AdjustmentKindDebit takes away from what the user paid.
+	AdjustmentKindDebit AdjustmentKind = "debit"
+)
+
+// Adjustment is a manual change to what a user paid for the tax of a rule in a period.
+type Adjustment struct {
+	ID                primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	TaxRuleID         primitive.ObjectID `json:"tax_rule_id" bson:"tax_rule_id"`
+	BroadcasterUserID string             `json:"broadcaster_user_id" bson:"broadcaster_user_id"`
+	UserID            string             `json:"user_id" bson:"user_id"`
+	PeriodStart       time.Time          `json:"period_start" bson:"period_start"`
+	Kind              AdjustmentKind     `json:"kind" bson:"kind"`
+	// Count and Amount are the redemptions and points credited or debited.
+	Count     int32     `json:"count" bson:"count"`
+	Amount    int32     `json:"amount" bson:"amount"`
+	Reason    string    `json:"reason" bson:"reason"`
+	CreatedBy string    `json:"created_by" bson:"created_by"`
+	CreatedAt time.Time `json:"created_at" bson:"created_at"`
+}
+
+type LedgerEntryKind string
+
+const (
+	LedgerEntryKindRedemption LedgerEntryKind = "redemption"
+	LedgerEntryKindRefund     LedgerEntryKind = "refund"
+	LedgerEntryKindAdjustment LedgerEntryKind = "adjustment"
+)
+
+// LedgerEntry is an immutable change to the points a user paid a broadcaster, refunds and debits are negative.
+type LedgerEntry struct {
+	ID primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	// Key identifies what the entry was made for, so nothing is entered twice.
+	Key               string             `json:"-" bson:"key"`
+	BroadcasterUserID string             `json:"broadcaster_user_id" bson:"broadcaster_user_id"`
+	UserID            string             `json:"user_id" bson:"user_id"`
+	Kind              LedgerEntryKind    `json:"kind" bson:"kind"`
+	Amount            int32              `json:"amount" bson:"amount"`
+	RewardID          string             `json:"reward_id,omitempty" bson:"reward_id,omitempty"`
+	RedemptionID      string             `json:"redemption_id,omitempty" bson:"redemption_id,omitempty"`
+	AdjustmentID      primitive.ObjectID `json:"adjustment_id,omitempty" bson:"adjustment_id,omitempty"`
+	// OccurredAt is when the redemption, refund or adjustment happened, entries are ordered by it.
+	OccurredAt time.Time `json:"occurred_at" bson:"occurred_at"`
+	CreatedAt  time.Time `json:"created_at" bson:"created_at"`
+	// Pending is set until the entry was added to the balance.
+	Pending bool `json:"-" bson:"pending,omitempty"`
+}
+
+// Balance is the running total of the ledger entries of a user for a broadcaster.
+type Balance struct {
+	ID                primitive.ObjectID `json:"-" bson:"_id,omitempty"`
+	BroadcasterUserID string             `json:"broadcaster_user_id" bson:"broadcaster_user_id"`
+	UserID            string             `json:"user_id" bson:"user_id"`
+	Balance           int64              `json:"balance" bson:"balance"`
+	Redeemed          int64              `json:"redeemed" bson:"redeemed"`
+	Refunded          int64              `json:"refunded" bson:"refunded"`
+	Adjusted          int64              `json:"adjusted" bson:"adjusted"`
+	Entries           int64              `json:"entries" bson:"entries"`
+	UpdatedAt         time.Time          `json:"updated_at" bson:"updated_at"`
+	// RecentKeys are the keys of the last entries added, so a retried entry is not added twice.
+	RecentKeys []string `json:"-" bson:"recent_keys,omitempty"`
+}
+
+type APIKeyPermission string
+
+const (
+	APIKeyPermissionReadResults APIKeyPermission = "read_results"
+	APIKeyPermissionManageRules APIKeyPermission = "manage_rules"
+	// APIKeyPermissionAdmin allows everything, including what the other permissions do.
+	APIKeyPermissionAdmin APIKeyPermission = "admin"
+)
+
+// APIKey is a credential for the API, only the sha256 of the key is stored.
+type APIKey struct {
+	ID   primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	Name string             `json:"name" bson:"name"`
+	Hash string             `json:"-" bson:"hash"`
+	// BroadcasterUserID limits the key to the data of a broadcaster, it is empty for keys to every broadcaster.
+	BroadcasterUserID string             `json:"broadcaster_user_id,omitempty" bson:"broadcaster_user_id,omitempty"`
+	Permissions       []APIKeyPermission `json:"permissions" bson:"permissions"`
+	CreatedAt         time.Time          `json:"created_at" bson:"created_at"`
+	RevokedAt         time.Time          `json:"revoked_at,omitempty" bson:"revoked_at,omitempty"`
+}
+
+type RosterSource string
+
+const (
+	RosterSourceManual      RosterSource = "manual"
+	RosterSourceImport      RosterSource = "import"
+	RosterSourceModerators  RosterSource = "mods"
+	RosterSourceVIPs        RosterSource = "vips"
+	RosterSourceSubscribers RosterSource = "subs"
+)
+
+// RosterMember is a user who is supposed to pay the taxes of a broadcaster.
+type RosterMember struct {
+	ID                primitive.ObjectID `json:"-" bson:"_id,omitempty"`
+	BroadcasterUserID string             `json:"broadcaster_user_id" bson:"broadcaster_user_id"`
+	UserID            string             `json:"user_id" bson:"user_id"`
+	UserLogin         string             `json:"user_login,omitempty" bson:"user_login,omitempty"`
+	UserName          string             `json:"user_name,omitempty" bson:"user_name,omitempty"`
+	// Sources are the ways the member was added, they leave the roster once they have none left.
+	Sources   []RosterSource `json:"sources" bson:"sources"`
+	AddedAt   time.Time      `json:"added_at" bson:"added_at"`
+	UpdatedAt time.Time      `json:"updated_at" bson:"updated_at"`
+}
+
+type RedeemStatus string
+
+const (
+	RedeemStatusUnfulfilled RedeemStatus = "unfulfilled"
+	RedeemStatusFulfilled   RedeemStatus = "fulfilled"
+	RedeemStatusCanceled    RedeemStatus = "canceled"
+)
+
 type RedeemEvent struct {
-	ID         primitive.ObjectID `json:"-" bson:"_id,omitempty"`
-	TwitchID   string             `json:"-" bson:"twitch_id"`
-	RewardID   string             `json:"-" bson:"reward_id"`
-	RewardName string             `json:"-" bson:"reward_name"`
-	UserID     string             `json:"user_id" bson:"user_id"`
-	UserName   string             `json:"-" bson:"user_name"`
-	Cost       int32              `json:"cost" bson:"cost"`
-	RedeemedAt time.Time          `json:"redeemed_at" bson:"redeemed_at"`
+	ID       primitive.ObjectID `json:"-" bson:"_id,omitempty"`
+	TwitchID string             `json:"-" bson:"twitch_id"`
+	// BroadcasterUserID is empty on redemptions stored before it was recorded, until they are migrated.
+	BroadcasterUserID string       `json:"-" bson:"broadcaster_user_id,omitempty"`
+	BroadcasterLogin  string       `json:"-" bson:"broadcaster_login,omitempty"`
+	RewardID          string       `json:"-" bson:"reward_id"`
+	RewardName        string       `json:"-" bson:"reward_name"`
+	UserID            string       `json:"user_id" bson:"user_id"`
+	UserName          string       `json:"-" bson:"user_name"`
+	Cost              int32        `json:"cost" bson:"cost"`
+	Status            RedeemStatus `json:"status" bson:"status"`
+	RedeemedAt        time.Time    `json:"redeemed_at" bson:"redeemed_at"`
+	UpdatedAt         time.Time    `json:"-" bson:"updated_at,omitempty"`
+
+	// StatusChangedBy is who changed the status through us, the broadcaster's own changes are not attributed.
+	StatusChangedBy string    `json:"-" bson:"status_changed_by,omitempty"`
+	StatusChangedAt time.Time `json:"-" bson:"status_changed_at,omitempty"`
+
+	RawEventIDs []primitive.ObjectID `json:"-" bson:"raw_event_ids,omitempty"`
+}
+
+type RawEvent struct {
+	ID                primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	MessageID         string             `json:"message_id" bson:"message_id"`
+	Transport         string             `json:"transport" bson:"transport"`
+	MessageType       string             `json:"message_type" bson:"message_type"`
+	SubscriptionType  string             `json:"subscription_type" bson:"subscription_type"`
+	BroadcasterUserID string             `json:"broadcaster_user_id" bson:"broadcaster_user_id"`
+	Headers           map[string]string  `json:"headers" bson:"headers"`
+	Body              string             `json:"body" bson:"body"`
+	ReceivedAt        time.Time          `json:"received_at" bson:"received_at"`
+	ProcessedAt       time.Time          `json:"processed_at" bson:"processed_at,omitempty"`
+	Error             string             `json:"error,omitempty" bson:"error,omitempty"`
 }
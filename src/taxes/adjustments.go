@@ -0,0 +1,100 @@
+package taxes
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/AdmiralBulldogTv/BulldogTax/src/global"
+	"github.com/AdmiralBulldogTv/BulldogTax/src/ledger"
+	"github.com/AdmiralBulldogTv/BulldogTax/src/mongo"
+	"github.com/AdmiralBulldogTv/BulldogTax/src/structures"
+	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Adjustments returns the adjustments of the rule for periods starting in [from, to), of every user when userID is empty.
+func Adjustments(gCtx global.Context, ctx context.Context, rule structures.TaxRule, from time.Time, to time.Time, userID string) ([]structures.Adjustment, error) {
+	filter := bson.M{
+		"tax_rule_id": rule.ID,
+		"period_start": bson.M{
+			"$gte": from,
+			"$lt":  to,
+		},
+	}
+	if userID != "" {
+		filter["user_id"] = userID
+	}
+
+	cur, err := gCtx.Inst().Mongo.Collection(mongo.CollectionNameAdjustments).Find(ctx, filter, options.Find().SetSort(bson.D{
+		{Key: "period_start", Value: 1},
+		{Key: "created_at", Value: 1},
+	}))
+
+	results := []structures.Adjustment{}
+	if err == nil {
+		err = cur.All(ctx, &results)
+	}
+
+	return results, err
+}
+
+// ValidateAdjustment checks an adjustment before it is stored, credits and debits need a count or an amount.
+func ValidateAdjustment(adj structures.Adjustment) error {
+	if adj.UserID == "" {
+		return fmt.Errorf("user_id is required")
+	}
+	if adj.Reason == "" || adj.CreatedBy == "" {
+		return fmt.Errorf("reason and created_by are required")
+	}
+	switch adj.Kind {
+	case structures.AdjustmentKindExempt:
+	case structures.AdjustmentKindCredit, structures.AdjustmentKindDebit:
+		if adj.Count < 0 || adj.Amount < 0 || adj.Count+adj.Amount == 0 {
+			return fmt.Errorf("count or amount must be positive")
+		}
+	default:
+		return fmt.Errorf("kind must be exempt, credit or debit")
+	}
+
+	return nil
+}
+
+// AddAdjustment stores an adjustment to the tax of the period at falls in. Adjustments are never changed,
+// a mistake is corrected with another adjustment.
+func AddAdjustment(gCtx global.Context, ctx context.Context, rule structures.TaxRule, adj structures.Adjustment, at time.Time) (structures.Adjustment, error) {
+	loc, err := Location(rule)
+	if err != nil {
+		return adj, err
+	}
+
+	adj.PeriodStart, err = PeriodStart(rule.Recurrence, loc, at)
+	if err != nil {
+		return adj, err
+	}
+
+	if adj.Kind == structures.AdjustmentKindExempt {
+		adj.Count, adj.Amount = 0, 0
+	}
+
+	adj.ID = primitive.NewObjectID()
+	adj.TaxRuleID = rule.ID
+	adj.BroadcasterUserID = rule.BroadcasterUserID
+	adj.CreatedAt = time.Now()
+
+	if _, err := gCtx.Inst().Mongo.Collection(mongo.CollectionNameAdjustments).InsertOne(ctx, adj); err != nil {
+		return adj, err
+	}
+
+	if err := ledger.RecordAdjustment(gCtx, ctx, adj); err != nil {
+		return adj, err
+	}
+
+	if err := publishRule(gCtx, ctx, rule, adj.UserID, adj.PeriodStart); err != nil {
+		logrus.Errorf("taxes, err=%v", err)
+	}
+
+	return adj, nil
+}
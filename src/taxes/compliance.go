@@ -0,0 +1,178 @@
+package taxes
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/AdmiralBulldogTv/BulldogTax/src/global"
+	"github.com/AdmiralBulldogTv/BulldogTax/src/mongo"
+	"github.com/AdmiralBulldogTv/BulldogTax/src/structures"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// UserCompliance is what a user paid in a period, adjustments included.
+type UserCompliance struct {
+	UserID    string `json:"user_id"`
+	Count     int32  `json:"count"`
+	Amount    int32  `json:"amount"`
+	Exempt    bool   `json:"exempt"`
+	Compliant bool   `json:"compliant"`
+}
+
+type PeriodCompliance struct {
+	Period
+	Users []UserCompliance `json:"users"`
+}
+
+// Evaluate works out per period whether every user who paid the tax in [from, to) paid enough.
+// Users who paid in any of the periods are listed in all of them, along with the users in include.
+func Evaluate(gCtx global.Context, ctx context.Context, rule structures.TaxRule, from time.Time, to time.Time, include []string) ([]PeriodCompliance, error) {
+	return evaluate(gCtx, ctx, rule, from, to, include, "")
+}
+
+// evaluate is Evaluate, limited to the redemptions and adjustments of the user when userID is set.
+func evaluate(gCtx global.Context, ctx context.Context, rule structures.TaxRule, from time.Time, to time.Time, include []string, userID string) ([]PeriodCompliance, error) {
+	// only the redemptions of the rule's broadcaster pay it, rules stored before it was required have none.
+	if rule.BroadcasterUserID == "" {
+		return nil, ErrNoBroadcaster
+	}
+
+	periods, err := Periods(rule, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]PeriodCompliance, len(periods))
+	if len(periods) == 0 {
+		return results, nil
+	}
+
+	paid := make([]map[string]*UserCompliance, len(periods))
+	for i := range paid {
+		paid[i] = map[string]*UserCompliance{}
+	}
+	users := map[string]bool{}
+	for _, id := range include {
+		users[id] = true
+	}
+
+	entry := func(t time.Time, userID string) *UserCompliance {
+		i := sort.Search(len(periods), func(i int) bool {
+			return periods[i].End.After(t)
+		})
+		if i == len(periods) || t.Before(periods[i].Start) {
+			return nil
+		}
+
+		uc := paid[i][userID]
+		if uc == nil {
+			uc = &UserCompliance{UserID: userID}
+			paid[i][userID] = uc
+		}
+		users[userID] = true
+
+		return uc
+	}
+
+	filter := bson.M{
+		"broadcaster_user_id": rule.BroadcasterUserID,
+		"reward_id": bson.M{
+			"$in": rule.RewardIDs,
+		},
+		"redeemed_at": bson.M{
+			"$gte": periods[0].Start,
+			"$lt":  periods[len(periods)-1].End,
+		},
+		// canceled redemptions were refunded.
+		"status": bson.M{
+			"$ne": structures.RedeemStatusCanceled,
+		},
+	}
+	if userID != "" {
+		filter["user_id"] = userID
+	}
+
+	cur, err := gCtx.Inst().Mongo.Collection(mongo.CollectionNameRedeemRewards).Find(ctx, filter, options.Find().SetProjection(bson.M{
+		"user_id":     1,
+		"cost":        1,
+		"redeemed_at": 1,
+	}))
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+
+	for cur.Next(ctx) {
+		ev := structures.RedeemEvent{}
+		if err := cur.Decode(&ev); err != nil {
+			return nil, err
+		}
+
+		if uc := entry(ev.RedeemedAt, ev.UserID); uc != nil {
+			uc.Count++
+			uc.Amount += ev.Cost
+		}
+	}
+	if err := cur.Err(); err != nil {
+		return nil, err
+	}
+
+	adjustments, err := Adjustments(gCtx, ctx, rule, periods[0].Start, periods[len(periods)-1].End, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, adj := range adjustments {
+		uc := entry(adj.PeriodStart, adj.UserID)
+		if uc == nil {
+			continue
+		}
+
+		switch adj.Kind {
+		case structures.AdjustmentKindExempt:
+			uc.Exempt = true
+		case structures.AdjustmentKindCredit:
+			uc.Count += adj.Count
+			uc.Amount += adj.Amount
+		case structures.AdjustmentKindDebit:
+			uc.Count -= adj.Count
+			uc.Amount -= adj.Amount
+		}
+	}
+
+	userIDs := make([]string, 0, len(users))
+	for id := range users {
+		userIDs = append(userIDs, id)
+	}
+	sort.Strings(userIDs)
+
+	for i, period := range periods {
+		results[i] = PeriodCompliance{
+			Period: period,
+			Users:  make([]UserCompliance, len(userIDs)),
+		}
+
+		for j, id := range userIDs {
+			uc := UserCompliance{UserID: id}
+			if p := paid[i][id]; p != nil {
+				uc = *p
+			}
+			uc.Compliant = uc.Exempt || Compliant(rule, uc.Count, uc.Amount)
+			results[i].Users[j] = uc
+		}
+	}
+
+	return results, nil
+}
+
+// Compliant reports whether count redemptions worth amount points pay the tax of one period,
+// a rule without requirements still needs one redemption.
+func Compliant(rule structures.TaxRule, count int32, amount int32) bool {
+	if rule.RequiredCount == 0 && rule.RequiredAmount == 0 {
+		return count > 0
+	}
+
+	return count >= rule.RequiredCount && amount >= rule.RequiredAmount
+}
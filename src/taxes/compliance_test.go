@@ -0,0 +1,161 @@
+package taxes
+
+import (
+	"testing"
+	"time"
+
+	"github.com/AdmiralBulldogTv/BulldogTax/src/configure"
+	"github.com/AdmiralBulldogTv/BulldogTax/src/structures"
+	"github.com/AdmiralBulldogTv/BulldogTax/src/testutil"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestCompliant(t *testing.T) {
+	tests := []struct {
+		name   string
+		rule   structures.TaxRule
+		count  int32
+		amount int32
+		want   bool
+	}{
+		{"count met", structures.TaxRule{RequiredCount: 2}, 2, 100, true},
+		{"count missed", structures.TaxRule{RequiredCount: 2}, 1, 10000, false},
+		{"amount met", structures.TaxRule{RequiredAmount: 1000}, 1, 1000, true},
+		{"amount met with credits", structures.TaxRule{RequiredAmount: 1000}, 0, 1000, true},
+		{"amount missed", structures.TaxRule{RequiredAmount: 1000}, 3, 999, false},
+		{"both met", structures.TaxRule{RequiredCount: 1, RequiredAmount: 1000}, 1, 1000, true},
+		{"one of both missed", structures.TaxRule{RequiredCount: 2, RequiredAmount: 1000}, 1, 1000, false},
+		{"no requirements", structures.TaxRule{}, 1, 0, true},
+		{"no requirements nothing paid", structures.TaxRule{}, 0, 0, false},
+		{"debited below zero", structures.TaxRule{}, -1, 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Compliant(tt.rule, tt.count, tt.amount); got != tt.want {
+				t.Errorf("Compliant() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEvaluate(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+
+	day := func(d int, hour int) time.Time {
+		return time.Date(2022, 3, d, hour, 0, 0, 0, time.UTC)
+	}
+	redemption := func(userID string, cost int32, at time.Time) bson.D {
+		return bson.D{{Key: "user_id", Value: userID}, {Key: "cost", Value: cost}, {Key: "redeemed_at", Value: at}}
+	}
+	adjustment := func(userID string, kind structures.AdjustmentKind, count int32, at time.Time) bson.D {
+		return bson.D{{Key: "user_id", Value: userID}, {Key: "kind", Value: string(kind)}, {Key: "count", Value: count}, {Key: "period_start", Value: at}}
+	}
+
+	rule := structures.TaxRule{
+		ID:                primitive.NewObjectID(),
+		BroadcasterUserID: "1",
+		RewardIDs:         []string{"reward"},
+		Recurrence:        structures.TaxRecurrenceDaily,
+		RequiredCount:     2,
+	}
+
+	mt.Run("periods", func(mt *mtest.T) {
+		gCtx, _ := testutil.Context(mt, &configure.Config{})
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(0, "db.redeem_rewards", mtest.FirstBatch,
+				redemption("a", 100, day(1, 10)),
+				redemption("a", 100, day(1, 20)),
+				redemption("b", 100, day(1, 12)),
+				redemption("b", 100, day(2, 12)),
+				redemption("a", 100, day(3, 0)),
+			),
+			mtest.CreateCursorResponse(0, "db.adjustments", mtest.FirstBatch,
+				adjustment("b", structures.AdjustmentKindCredit, 1, day(1, 0)),
+				adjustment("a", structures.AdjustmentKindDebit, 1, day(2, 0)),
+				adjustment("b", structures.AdjustmentKindExempt, 0, day(2, 0)),
+			),
+		)
+
+		periods, err := Evaluate(gCtx, mtest.Background, rule, day(1, 0), day(3, 0), []string{"c"})
+		if err != nil {
+			mt.Fatalf("Evaluate() err = %v", err)
+		}
+
+		// the redemption on the third day falls in a period that was not asked for.
+		want := []map[string]UserCompliance{
+			{
+				"a": {UserID: "a", Count: 2, Amount: 200, Compliant: true},
+				"b": {UserID: "b", Count: 2, Amount: 100, Compliant: true},
+				"c": {UserID: "c"},
+			},
+			{
+				"a": {UserID: "a", Count: -1},
+				"b": {UserID: "b", Count: 1, Amount: 100, Exempt: true, Compliant: true},
+				"c": {UserID: "c"},
+			},
+		}
+		if len(periods) != len(want) {
+			mt.Fatalf("Evaluate() = %d periods, want %d", len(periods), len(want))
+		}
+		for i, p := range periods {
+			if !p.Start.Equal(day(i+1, 0)) || !p.End.Equal(day(i+2, 0)) {
+				mt.Errorf("period %d = %v - %v", i, p.Start, p.End)
+			}
+			if len(p.Users) != len(want[i]) {
+				mt.Errorf("period %d users = %v, want %v", i, p.Users, want[i])
+				continue
+			}
+			for _, uc := range p.Users {
+				if uc != want[i][uc.UserID] {
+					mt.Errorf("period %d user %s = %+v, want %+v", i, uc.UserID, uc, want[i][uc.UserID])
+				}
+			}
+		}
+
+		find := mt.GetStartedEvent()
+		filter := find.Command.Lookup("filter").Document()
+		if status := filter.Lookup("status", "$ne").StringValue(); status != string(structures.RedeemStatusCanceled) {
+			mt.Errorf("redemptions filter status $ne = %q, canceled ones were refunded", status)
+		}
+		if reward := filter.Lookup("reward_id", "$in").Array().Index(0).Value().StringValue(); reward != "reward" {
+			mt.Errorf("redemptions filter reward_id $in = %q, want the rewards of the rule", reward)
+		}
+		if broadcaster := filter.Lookup("broadcaster_user_id").StringValue(); broadcaster != "1" {
+			mt.Errorf("redemptions filter broadcaster_user_id = %q, want the broadcaster of the rule", broadcaster)
+		}
+	})
+
+	mt.Run("no broadcaster", func(mt *mtest.T) {
+		gCtx, _ := testutil.Context(mt, &configure.Config{})
+
+		r := rule
+		r.BroadcasterUserID = ""
+		if _, err := Evaluate(gCtx, mtest.Background, r, day(1, 0), day(3, 0), nil); err != ErrNoBroadcaster {
+			mt.Errorf("Evaluate() err = %v, want %v", err, ErrNoBroadcaster)
+		}
+		if len(mt.GetAllStartedEvents()) != 0 {
+			mt.Error("Evaluate() queried the redemptions of every broadcaster")
+		}
+	})
+
+	mt.Run("not effective", func(mt *mtest.T) {
+		gCtx, _ := testutil.Context(mt, &configure.Config{})
+
+		r := rule
+		r.EffectiveFrom = day(10, 0)
+		periods, err := Evaluate(gCtx, mtest.Background, r, day(1, 0), day(3, 0), nil)
+		if err != nil {
+			mt.Fatalf("Evaluate() err = %v", err)
+		}
+		if len(periods) != 0 {
+			mt.Errorf("Evaluate() = %v, want no periods", periods)
+		}
+		if len(mt.GetAllStartedEvents()) != 0 {
+			mt.Error("Evaluate() queried without periods")
+		}
+	})
+}
@@ -0,0 +1,124 @@
+package taxes
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/AdmiralBulldogTv/BulldogTax/src/global"
+	"github.com/AdmiralBulldogTv/BulldogTax/src/roster"
+	"github.com/AdmiralBulldogTv/BulldogTax/src/structures"
+)
+
+var ErrNoBroadcaster = fmt.Errorf("rule has no broadcaster, set its broadcaster_user_id")
+
+// Delinquent is a roster member who did not pay the tax of a period.
+type Delinquent struct {
+	UserID    string `json:"user_id"`
+	UserLogin string `json:"user_login,omitempty"`
+	UserName  string `json:"user_name,omitempty"`
+	// Count and Amount are what they paid in the period, not enough when it is not zero.
+	Count  int32 `json:"count"`
+	Amount int32 `json:"amount"`
+	// Streak is the number of periods in a row they missed, up to and including this one.
+	Streak int `json:"streak"`
+	// Arrears is the number of periods they missed since they joined the roster.
+	Arrears int `json:"arrears"`
+}
+
+type DelinquencyReport struct {
+	Period      Period       `json:"period"`
+	Members     int          `json:"members"`
+	Delinquents []Delinquent `json:"delinquents"`
+}
+
+// Delinquents lists the roster members of the rule's broadcaster who did not pay the tax of the period at falls in.
+// Periods before a member joined the roster are not held against them.
+func Delinquents(gCtx global.Context, ctx context.Context, rule structures.TaxRule, at time.Time) (DelinquencyReport, error) {
+	report := DelinquencyReport{
+		Delinquents: []Delinquent{},
+	}
+
+	if rule.BroadcasterUserID == "" {
+		return report, ErrNoBroadcaster
+	}
+
+	loc, err := Location(rule)
+	if err != nil {
+		return report, err
+	}
+
+	start, err := PeriodStart(rule.Recurrence, loc, at)
+	if err != nil {
+		return report, err
+	}
+	report.Period = Period{
+		Start: start,
+		End:   NextPeriod(rule.Recurrence, start),
+	}
+
+	members, err := roster.List(gCtx, ctx, rule.BroadcasterUserID)
+	if err != nil {
+		return report, err
+	}
+	report.Members = len(members)
+
+	ids := make([]string, len(members))
+	for i, m := range members {
+		ids[i] = m.UserID
+	}
+
+	periods, err := Evaluate(gCtx, ctx, rule, rule.EffectiveFrom, report.Period.End, ids)
+	if err != nil {
+		return report, err
+	}
+	// the period is outside of the range the rule is effective in.
+	if len(periods) == 0 || !periods[len(periods)-1].Start.Equal(report.Period.Start) {
+		return report, nil
+	}
+
+	// every period lists the same users in the same order.
+	history := map[string][]UserCompliance{}
+	for _, p := range periods {
+		for _, uc := range p.Users {
+			history[uc.UserID] = append(history[uc.UserID], uc)
+		}
+	}
+
+	for _, m := range members {
+		h := history[m.UserID]
+		current := h[len(h)-1]
+		if current.Compliant {
+			continue
+		}
+
+		d := Delinquent{
+			UserID:    m.UserID,
+			UserLogin: m.UserLogin,
+			UserName:  m.UserName,
+			Count:     current.Count,
+			Amount:    current.Amount,
+		}
+
+		counting := true
+		for i := len(h) - 1; i >= 0; i-- {
+			if !periods[i].End.After(m.AddedAt) {
+				break
+			}
+
+			if h[i].Compliant {
+				counting = false
+				continue
+			}
+
+			d.Arrears++
+			if counting {
+				d.Streak++
+			}
+		}
+
+		report.Delinquents = append(report.Delinquents, d)
+	}
+
+	return report, nil
+}
@@ -0,0 +1,98 @@
+package taxes
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/AdmiralBulldogTv/BulldogTax/src/structures"
+)
+
+// MaxPeriods is the most periods worked out at once.
+const MaxPeriods = 5000
+
+var (
+	ErrInvalidRecurrence = fmt.Errorf("recurrence must be daily, weekly or monthly")
+	ErrTooManyPeriods    = fmt.Errorf("too many periods, at most %d", MaxPeriods)
+)
+
+// Period is a half open interval a tax has to be paid in.
+type Period struct {
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+}
+
+// Location loads the time zone of the rule, UTC when it has none.
+func Location(rule structures.TaxRule) (*time.Location, error) {
+	if rule.TimeZone == "" {
+		return time.UTC, nil
+	}
+
+	return time.LoadLocation(rule.TimeZone)
+}
+
+// PeriodStart returns the start of the period of the rule that t falls in.
+func PeriodStart(recurrence structures.TaxRecurrence, loc *time.Location, t time.Time) (time.Time, error) {
+	t = t.In(loc)
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, loc)
+
+	switch recurrence {
+	case structures.TaxRecurrenceDaily:
+		return day, nil
+	case structures.TaxRecurrenceWeekly:
+		// weekdays count from sunday, weeks start on monday.
+		return day.AddDate(0, 0, -((int(day.Weekday()) + 6) % 7)), nil
+	case structures.TaxRecurrenceMonthly:
+		return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, loc), nil
+	}
+
+	return time.Time{}, ErrInvalidRecurrence
+}
+
+// NextPeriod returns the start of the period after the one starting at start.
+func NextPeriod(recurrence structures.TaxRecurrence, start time.Time) time.Time {
+	switch recurrence {
+	case structures.TaxRecurrenceWeekly:
+		return start.AddDate(0, 0, 7)
+	case structures.TaxRecurrenceMonthly:
+		return start.AddDate(0, 1, 0)
+	}
+
+	return start.AddDate(0, 0, 1)
+}
+
+// Periods returns the periods of the rule overlapping [from, to), limited to the range the rule is effective in.
+// Periods are whole, the first one can start before from. More than MaxPeriods periods is ErrTooManyPeriods.
+func Periods(rule structures.TaxRule, from time.Time, to time.Time) ([]Period, error) {
+	loc, err := Location(rule)
+	if err != nil {
+		return nil, err
+	}
+
+	if from.Before(rule.EffectiveFrom) {
+		from = rule.EffectiveFrom
+	}
+	if !rule.EffectiveUntil.IsZero() && to.After(rule.EffectiveUntil) {
+		to = rule.EffectiveUntil
+	}
+
+	start, err := PeriodStart(rule.Recurrence, loc, from)
+	if err != nil {
+		return nil, err
+	}
+
+	periods := []Period{}
+	for start.Before(to) {
+		if len(periods) == MaxPeriods {
+			return nil, ErrTooManyPeriods
+		}
+
+		end := NextPeriod(rule.Recurrence, start)
+		periods = append(periods, Period{
+			Start: start,
+			End:   end,
+		})
+		start = end
+	}
+
+	return periods, nil
+}
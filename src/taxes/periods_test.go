@@ -0,0 +1,161 @@
+package taxes
+
+import (
+	"testing"
+	"time"
+
+	"github.com/AdmiralBulldogTv/BulldogTax/src/structures"
+)
+
+func TestPeriodStart(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skipf("no time zone database: %v", err)
+	}
+	cet := time.FixedZone("CET", 60*60)
+	cest := time.FixedZone("CEST", 2*60*60)
+
+	tests := []struct {
+		name       string
+		recurrence structures.TaxRecurrence
+		loc        *time.Location
+		t          time.Time
+		want       time.Time
+	}{
+		{"daily", structures.TaxRecurrenceDaily, time.UTC, time.Date(2022, 3, 2, 15, 4, 5, 0, time.UTC), time.Date(2022, 3, 2, 0, 0, 0, 0, time.UTC)},
+		{"daily in the time zone", structures.TaxRecurrenceDaily, berlin, time.Date(2022, 3, 1, 23, 30, 0, 0, time.UTC), time.Date(2022, 3, 2, 0, 0, 0, 0, cet)},
+		{"weekly on a wednesday", structures.TaxRecurrenceWeekly, time.UTC, time.Date(2022, 3, 2, 12, 0, 0, 0, time.UTC), time.Date(2022, 2, 28, 0, 0, 0, 0, time.UTC)},
+		{"weekly on a monday", structures.TaxRecurrenceWeekly, time.UTC, time.Date(2022, 2, 28, 0, 0, 0, 0, time.UTC), time.Date(2022, 2, 28, 0, 0, 0, 0, time.UTC)},
+		{"weekly on a sunday", structures.TaxRecurrenceWeekly, time.UTC, time.Date(2022, 3, 6, 23, 59, 0, 0, time.UTC), time.Date(2022, 2, 28, 0, 0, 0, 0, time.UTC)},
+		{"weekly over daylight saving", structures.TaxRecurrenceWeekly, berlin, time.Date(2022, 3, 28, 12, 0, 0, 0, cest), time.Date(2022, 3, 28, 0, 0, 0, 0, cest)},
+		{"weekly back over daylight saving", structures.TaxRecurrenceWeekly, berlin, time.Date(2022, 3, 27, 12, 0, 0, 0, cest), time.Date(2022, 3, 21, 0, 0, 0, 0, cet)},
+		{"monthly", structures.TaxRecurrenceMonthly, time.UTC, time.Date(2022, 2, 28, 12, 0, 0, 0, time.UTC), time.Date(2022, 2, 1, 0, 0, 0, 0, time.UTC)},
+		{"monthly in the time zone", structures.TaxRecurrenceMonthly, berlin, time.Date(2022, 3, 31, 22, 30, 0, 0, time.UTC), time.Date(2022, 4, 1, 0, 0, 0, 0, cest)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := PeriodStart(tt.recurrence, tt.loc, tt.t)
+			if err != nil {
+				t.Fatalf("PeriodStart() err = %v", err)
+			}
+			if !got.Equal(tt.want) {
+				t.Errorf("PeriodStart() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := PeriodStart("yearly", time.UTC, time.Now()); err != ErrInvalidRecurrence {
+		t.Errorf("PeriodStart() err = %v, want %v", err, ErrInvalidRecurrence)
+	}
+}
+
+func TestPeriods(t *testing.T) {
+	cet := time.FixedZone("CET", 60*60)
+	cest := time.FixedZone("CEST", 2*60*60)
+	if _, err := time.LoadLocation("Europe/Berlin"); err != nil {
+		t.Skipf("no time zone database: %v", err)
+	}
+
+	day := func(month time.Month, d int, loc *time.Location) time.Time {
+		return time.Date(2022, month, d, 0, 0, 0, 0, loc)
+	}
+
+	tests := []struct {
+		name string
+		rule structures.TaxRule
+		from time.Time
+		to   time.Time
+		want []Period
+	}{
+		{
+			name: "daily",
+			rule: structures.TaxRule{Recurrence: structures.TaxRecurrenceDaily},
+			from: day(3, 1, time.UTC).Add(time.Hour * 6),
+			to:   day(3, 3, time.UTC),
+			want: []Period{
+				{day(3, 1, time.UTC), day(3, 2, time.UTC)},
+				{day(3, 2, time.UTC), day(3, 3, time.UTC)},
+			},
+		},
+		{
+			name: "limited to when the rule is effective",
+			rule: structures.TaxRule{
+				Recurrence:     structures.TaxRecurrenceDaily,
+				EffectiveFrom:  day(3, 2, time.UTC).Add(time.Hour),
+				EffectiveUntil: day(3, 3, time.UTC).Add(time.Hour),
+			},
+			from: day(3, 1, time.UTC),
+			to:   day(3, 10, time.UTC),
+			want: []Period{
+				{day(3, 2, time.UTC), day(3, 3, time.UTC)},
+				{day(3, 3, time.UTC), day(3, 4, time.UTC)},
+			},
+		},
+		{
+			name: "daily over daylight saving",
+			rule: structures.TaxRule{Recurrence: structures.TaxRecurrenceDaily, TimeZone: "Europe/Berlin"},
+			from: day(3, 26, cet),
+			to:   day(3, 28, cest),
+			want: []Period{
+				{day(3, 26, cet), day(3, 27, cet)},
+				{day(3, 27, cet), day(3, 28, cest)},
+			},
+		},
+		{
+			name: "weekly over daylight saving",
+			rule: structures.TaxRule{Recurrence: structures.TaxRecurrenceWeekly, TimeZone: "Europe/Berlin"},
+			from: day(10, 26, cest),
+			to:   day(11, 1, cet),
+			want: []Period{
+				{day(10, 24, cest), day(10, 31, cet)},
+				{day(10, 31, cet), day(11, 7, cet)},
+			},
+		},
+		{
+			name: "monthly",
+			rule: structures.TaxRule{Recurrence: structures.TaxRecurrenceMonthly},
+			from: day(1, 31, time.UTC),
+			to:   day(2, 2, time.UTC),
+			want: []Period{
+				{day(1, 1, time.UTC), day(2, 1, time.UTC)},
+				{day(2, 1, time.UTC), day(3, 1, time.UTC)},
+			},
+		},
+		{
+			name: "not effective",
+			rule: structures.TaxRule{Recurrence: structures.TaxRecurrenceDaily, EffectiveFrom: day(4, 1, time.UTC)},
+			from: day(3, 1, time.UTC),
+			to:   day(3, 10, time.UTC),
+			want: []Period{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			periods, err := Periods(tt.rule, tt.from, tt.to)
+			if err != nil {
+				t.Fatalf("Periods() err = %v", err)
+			}
+			if len(periods) != len(tt.want) {
+				t.Fatalf("Periods() = %v, want %v", periods, tt.want)
+			}
+			for i, p := range periods {
+				if !p.Start.Equal(tt.want[i].Start) || !p.End.Equal(tt.want[i].End) {
+					t.Errorf("period %d = %v - %v, want %v - %v", i, p.Start, p.End, tt.want[i].Start, tt.want[i].End)
+				}
+			}
+		})
+	}
+
+	if _, err := Periods(structures.TaxRule{Recurrence: structures.TaxRecurrenceDaily, TimeZone: "Nowhere/Else"}, time.Now(), time.Now()); err == nil {
+		t.Error("Periods() err = nil for an unknown time zone")
+	}
+
+	if _, err := Periods(structures.TaxRule{Recurrence: structures.TaxRecurrenceDaily}, day(1, 1, time.UTC), day(1, 1, time.UTC).AddDate(0, 0, MaxPeriods)); err != nil {
+		t.Errorf("Periods() err = %v for %d periods", err, MaxPeriods)
+	}
+	if _, err := Periods(structures.TaxRule{Recurrence: structures.TaxRecurrenceDaily}, day(1, 1, time.UTC), day(1, 1, time.UTC).AddDate(0, 0, MaxPeriods+1)); err != ErrTooManyPeriods {
+		t.Errorf("Periods() err = %v, want %v", err, ErrTooManyPeriods)
+	}
+}
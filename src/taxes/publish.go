@@ -0,0 +1,69 @@
+package taxes
+
+import (
+	"context"
+	"time"
+
+	"github.com/AdmiralBulldogTv/BulldogTax/src/feed"
+	"github.com/AdmiralBulldogTv/BulldogTax/src/global"
+	"github.com/AdmiralBulldogTv/BulldogTax/src/mongo"
+	"github.com/AdmiralBulldogTv/BulldogTax/src/structures"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// PublishCompliance sends where the user stands with every tax of the broadcaster on the reward,
+// after a redemption of it at changed what they paid in that period.
+func PublishCompliance(gCtx global.Context, ctx context.Context, broadcasterID string, rewardID string, userID string, at time.Time) error {
+	cur, err := gCtx.Inst().Mongo.Collection(mongo.CollectionNameTaxRules).Find(ctx, bson.M{
+		"broadcaster_user_id": broadcasterID,
+		"reward_ids":          rewardID,
+	})
+	if err != nil {
+		return err
+	}
+
+	rules := []structures.TaxRule{}
+	if err := cur.All(ctx, &rules); err != nil {
+		return err
+	}
+
+	for _, rule := range rules {
+		if err := publishRule(gCtx, ctx, rule, userID, at); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// publishRule sends where the user stands with the rule in the period at falls in, nothing when it is not effective then.
+func publishRule(gCtx global.Context, ctx context.Context, rule structures.TaxRule, userID string, at time.Time) error {
+	periods, err := evaluate(gCtx, ctx, rule, at, at.Add(time.Nanosecond), []string{userID}, userID)
+	if err != nil {
+		return err
+	}
+
+	for _, p := range periods {
+		for _, uc := range p.Users {
+			if uc.UserID != userID {
+				continue
+			}
+
+			if err := feed.PublishCompliance(gCtx, ctx, feed.Compliance{
+				RuleID:            rule.ID,
+				BroadcasterUserID: rule.BroadcasterUserID,
+				PeriodStart:       p.Start,
+				PeriodEnd:         p.End,
+				UserID:            uc.UserID,
+				Count:             uc.Count,
+				Amount:            uc.Amount,
+				Exempt:            uc.Exempt,
+				Compliant:         uc.Compliant,
+			}); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,95 @@
+package taxes
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/AdmiralBulldogTv/BulldogTax/src/global"
+	"github.com/AdmiralBulldogTv/BulldogTax/src/mongo"
+	"github.com/AdmiralBulldogTv/BulldogTax/src/structures"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var ErrForeignReward = fmt.Errorf("reward is not a stored reward of the broadcaster, sync the rewards of the broadcaster first")
+
+// Validate checks a rule before it is stored.
+func Validate(rule structures.TaxRule) error {
+	if rule.BroadcasterUserID == "" {
+		return fmt.Errorf("broadcaster_user_id is required")
+	}
+	if rule.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+	if len(rule.RewardIDs) == 0 {
+		return fmt.Errorf("reward_ids is required")
+	}
+	if _, err := PeriodStart(rule.Recurrence, time.UTC, time.Now()); err != nil {
+		return err
+	}
+	if _, err := Location(rule); err != nil {
+		return fmt.Errorf("invalid time_zone: %v", err)
+	}
+	if rule.RequiredCount < 0 || rule.RequiredAmount < 0 {
+		return fmt.Errorf("required_count and required_amount cannot be negative")
+	}
+	if rule.EffectiveFrom.IsZero() {
+		return fmt.Errorf("effective_from is required")
+	}
+	if !rule.EffectiveUntil.IsZero() && !rule.EffectiveUntil.After(rule.EffectiveFrom) {
+		return fmt.Errorf("effective_until must be after effective_from")
+	}
+
+	return nil
+}
+
+// ValidateRewards checks that every reward of the rule is a stored reward of its broadcaster.
+func ValidateRewards(gCtx global.Context, ctx context.Context, rule structures.TaxRule) error {
+	cur, err := gCtx.Inst().Mongo.Collection(mongo.CollectionNameRewards).Find(ctx, bson.M{
+		"broadcaster_user_id": rule.BroadcasterUserID,
+		"twitch_id": bson.M{
+			"$in": rule.RewardIDs,
+		},
+	})
+
+	rewards := []structures.Reward{}
+	if err == nil {
+		err = cur.All(ctx, &rewards)
+	}
+	if err != nil {
+		return err
+	}
+
+	owned := map[string]bool{}
+	for _, r := range rewards {
+		owned[r.TwitchID] = true
+	}
+	for _, id := range rule.RewardIDs {
+		if !owned[id] {
+			return fmt.Errorf("%w: %s", ErrForeignReward, id)
+		}
+	}
+
+	return nil
+}
+
+// GetRule returns the rule with the hex encoded id.
+func GetRule(gCtx global.Context, ctx context.Context, id string) (structures.TaxRule, error) {
+	rule := structures.TaxRule{}
+
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return rule, mongo.ErrNoDocuments
+	}
+
+	res := gCtx.Inst().Mongo.Collection(mongo.CollectionNameTaxRules).FindOne(ctx, bson.M{
+		"_id": oid,
+	})
+	err = res.Err()
+	if err == nil {
+		err = res.Decode(&rule)
+	}
+
+	return rule, err
+}
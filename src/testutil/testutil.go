@@ -0,0 +1,147 @@
+// Package testutil has stand-ins for the instances of a global.Context, for tests only.
+package testutil
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/AdmiralBulldogTv/BulldogTax/src/configure"
+	"github.com/AdmiralBulldogTv/BulldogTax/src/global"
+	"github.com/AdmiralBulldogTv/BulldogTax/src/instance"
+	"github.com/go-redis/redis/v8"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+// Context returns a global.Context on the mock deployment of mt and a Redis in memory.
+func Context(mt *mtest.T, config *configure.Config) (global.Context, *Redis) {
+	gCtx := global.New(context.Background(), config)
+
+	r := NewRedis()
+	gCtx.Inst().Mongo = &Mongo{DB: mt.DB}
+	gCtx.Inst().Redis = r
+
+	return gCtx, r
+}
+
+// Mongo serves the collections of a database, usually the one of an mtest mock deployment.
+type Mongo struct {
+	DB *mongo.Database
+}
+
+func (m *Mongo) Collection(name instance.CollectionName) *mongo.Collection {
+	return m.DB.Collection(string(name))
+}
+
+func (m *Mongo) Ping(ctx context.Context) error {
+	return nil
+}
+
+func (m *Mongo) RawClient() *mongo.Client {
+	return m.DB.Client()
+}
+
+func (m *Mongo) RawDatabase() *mongo.Database {
+	return m.DB
+}
+
+// Message is a message published on a channel.
+type Message struct {
+	Channel string
+	Content string
+}
+
+// Redis keeps keys in memory and records what is published, expiry is ignored.
+type Redis struct {
+	mtx       sync.Mutex
+	values    map[string]string
+	published []Message
+}
+
+func NewRedis() *Redis {
+	return &Redis{
+		values: map[string]string{},
+	}
+}
+
+// Published returns the messages published so far.
+func (r *Redis) Published() []Message {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	return append([]Message{}, r.published...)
+}
+
+// Has reports whether the key is set.
+func (r *Redis) Has(key string) bool {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	_, ok := r.values[key]
+	return ok
+}
+
+func (r *Redis) Subscribe(ctx context.Context, ch chan string, subscribeTo ...string) {}
+
+func (r *Redis) Ping(ctx context.Context) error {
+	return nil
+}
+
+func (r *Redis) Publish(ctx context.Context, channel string, content string) error {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	r.published = append(r.published, Message{Channel: channel, Content: content})
+	return nil
+}
+
+func (r *Redis) Expire(ctx context.Context, key string, ttl time.Duration) error {
+	return nil
+}
+
+func (r *Redis) Del(ctx context.Context, key string) error {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	delete(r.values, key)
+	return nil
+}
+
+func (r *Redis) Get(ctx context.Context, key string) (interface{}, error) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	v, ok := r.values[key]
+	if !ok {
+		return nil, redis.Nil
+	}
+	return v, nil
+}
+
+func (r *Redis) SetNX(ctx context.Context, key string, value string, ttl time.Duration) (bool, error) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	if _, ok := r.values[key]; ok {
+		return false, nil
+	}
+	r.values[key] = value
+	return true, nil
+}
+
+func (r *Redis) SetEX(ctx context.Context, key string, value string, ttl time.Duration) error {
+	return r.Set(ctx, key, value)
+}
+
+func (r *Redis) Set(ctx context.Context, key string, value string) error {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	r.values[key] = value
+	return nil
+}
+
+func (r *Redis) RawClient() *redis.Client {
+	return nil
+}
@@ -0,0 +1,48 @@
+package tokens
+
+import (
+	"context"
+	"time"
+
+	"github.com/AdmiralBulldogTv/BulldogTax/src/global"
+	"github.com/sirupsen/logrus"
+)
+
+// lockKey is held by the instance refreshing the expiring tokens, and suffixed with the user id by whoever refreshes theirs.
+const lockKey = "twitch:tokens:refresh"
+
+// Refresher periodically refreshes the tokens that are about to expire, so they stay usable
+// by features that do not run on a request of the broadcaster.
+func Refresher(gCtx global.Context) <-chan struct{} {
+	interval := gCtx.Config().Tokens.RefreshInterval
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+
+		tick := time.NewTicker(interval)
+		defer tick.Stop()
+
+		for {
+			// only one instance refreshes per interval, a refresh token can only be used once.
+			set, err := gCtx.Inst().Redis.SetNX(gCtx, lockKey, "1", interval/2)
+			if err != nil {
+				logrus.Errorf("redis, err=%v", err)
+			} else if set {
+				ctx, cancel := context.WithTimeout(gCtx, interval/2)
+				if err := gCtx.Inst().Tokens.RefreshExpiring(ctx); err != nil {
+					logrus.Errorf("tokens, err=%v", err)
+				}
+				cancel()
+			}
+
+			select {
+			case <-gCtx.Done():
+				return
+			case <-tick.C:
+			}
+		}
+	}()
+
+	return done
+}
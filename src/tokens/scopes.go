@@ -0,0 +1,27 @@
+package tokens
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/AdmiralBulldogTv/BulldogTax/src/global"
+)
+
+// ErrMissingScope is returned when the broadcaster logged in before we requested a scope.
+var ErrMissingScope = fmt.Errorf("broadcaster did not grant the required scope, they need to login again")
+
+// ScopedAccessToken returns the access token of the broadcaster when they granted scope.
+func ScopedAccessToken(gCtx global.Context, ctx context.Context, userID string, scope string) (string, error) {
+	scopes, err := gCtx.Inst().Tokens.Scopes(ctx, userID)
+	if err != nil {
+		return "", err
+	}
+
+	for _, s := range scopes {
+		if s == scope {
+			return gCtx.Inst().Tokens.AccessToken(ctx, userID)
+		}
+	}
+
+	return "", ErrMissingScope
+}
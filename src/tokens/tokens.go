@@ -0,0 +1,321 @@
+package tokens
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/AdmiralBulldogTv/BulldogTax/src/encryption"
+	"github.com/AdmiralBulldogTv/BulldogTax/src/global"
+	"github.com/AdmiralBulldogTv/BulldogTax/src/instance"
+	"github.com/AdmiralBulldogTv/BulldogTax/src/mongo"
+	"github.com/AdmiralBulldogTv/BulldogTax/src/structures"
+	"github.com/AdmiralBulldogTv/BulldogTax/src/twitch"
+	"github.com/nicklaw5/helix"
+	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// DefaultRefreshBefore is how long before their expiry tokens are refreshed when it is not configured.
+const DefaultRefreshBefore = time.Minute * 15
+
+// refreshLockTTL bounds how long a refresh can hold the lock of a user, should its instance die while holding it.
+const refreshLockTTL = time.Second * 30
+
+// ErrNeedsRelogin is returned when the refresh token of a broadcaster was rejected, they have to login again.
+var ErrNeedsRelogin = fmt.Errorf("broadcaster needs to login again")
+
+type tokensInst struct {
+	gCtx   global.Context
+	key    []byte
+	keyErr error
+}
+
+// New creates the token store, tokens.key is used to encrypt them and falls back to encryption.key.
+// Without a valid key everything else still runs, only storing and using tokens fails.
+func New(gCtx global.Context) (instance.Tokens, error) {
+	k := gCtx.Config().Tokens.Key
+	if k == "" {
+		k = gCtx.Config().Encryption.Key
+	}
+
+	key, err := encryption.ParseKey(k)
+	if err != nil {
+		logrus.Warnf("tokens, broadcaster tokens cannot be stored or used until tokens.key or encryption.key is set, err=%v", err)
+	}
+
+	return &tokensInst{
+		gCtx:   gCtx,
+		key:    key,
+		keyErr: err,
+	}, nil
+}
+
+func (t *tokensInst) refreshBefore() time.Duration {
+	if t.gCtx.Config().Tokens.RefreshBefore > 0 {
+		return t.gCtx.Config().Tokens.RefreshBefore
+	}
+
+	return DefaultRefreshBefore
+}
+
+func (t *tokensInst) Save(ctx context.Context, userID string, creds helix.AccessCredentials) error {
+	if t.keyErr != nil {
+		return t.keyErr
+	}
+
+	access, err := encryption.Encrypt(t.key, creds.AccessToken)
+	if err != nil {
+		return err
+	}
+
+	refresh, err := encryption.Encrypt(t.key, creds.RefreshToken)
+	if err != nil {
+		return err
+	}
+
+	scopes := creds.Scopes
+	if scopes == nil {
+		scopes = []string{}
+	}
+
+	_, err = t.gCtx.Inst().Mongo.Collection(mongo.CollectionNameUserTokens).UpdateOne(ctx, bson.M{
+		"user_id": userID,
+	}, bson.M{
+		"$set": structures.UserToken{
+			UserID:       userID,
+			AccessToken:  access,
+			RefreshToken: refresh,
+			Scopes:       scopes,
+			ExpiresAt:    time.Now().Add(time.Duration(creds.ExpiresIn) * time.Second),
+			UpdatedAt:    time.Now(),
+		},
+	}, options.Update().SetUpsert(true))
+
+	return err
+}
+
+func (t *tokensInst) get(ctx context.Context, userID string) (structures.UserToken, error) {
+	tkn := structures.UserToken{}
+	res := t.gCtx.Inst().Mongo.Collection(mongo.CollectionNameUserTokens).FindOne(ctx, bson.M{
+		"user_id": userID,
+	})
+	err := res.Err()
+	if err == nil {
+		err = res.Decode(&tkn)
+	}
+
+	return tkn, err
+}
+
+func (t *tokensInst) AccessToken(ctx context.Context, userID string) (string, error) {
+	if t.keyErr != nil {
+		return "", t.keyErr
+	}
+
+	tkn, err := t.get(ctx, userID)
+	if err != nil {
+		return "", err
+	}
+
+	if time.Now().Before(tkn.ExpiresAt.Add(-time.Minute)) {
+		return encryption.Decrypt(t.key, tkn.AccessToken)
+	}
+
+	creds, err := t.refresh(ctx, tkn)
+	if err != nil {
+		return "", err
+	}
+
+	return creds.AccessToken, nil
+}
+
+func (t *tokensInst) Scopes(ctx context.Context, userID string) ([]string, error) {
+	tkn, err := t.get(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return tkn.Scopes, nil
+}
+
+func (t *tokensInst) Refresh(ctx context.Context, userID string) error {
+	tkn, err := t.get(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	_, err = t.refresh(ctx, tkn)
+	return err
+}
+
+func (t *tokensInst) RefreshExpiring(ctx context.Context) error {
+	cur, err := t.gCtx.Inst().Mongo.Collection(mongo.CollectionNameUserTokens).Find(ctx, bson.M{
+		"expires_at": bson.M{
+			"$lt": time.Now().Add(t.refreshBefore()),
+		},
+	})
+	tkns := []structures.UserToken{}
+	if err == nil {
+		err = cur.All(ctx, &tkns)
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, tkn := range tkns {
+		if _, err := t.refresh(ctx, tkn); err != nil && err != ErrNeedsRelogin {
+			logrus.Errorf("tokens, user=%s err=%v", tkn.UserID, err)
+		}
+	}
+
+	return nil
+}
+
+func (t *tokensInst) Delete(ctx context.Context, userID string) error {
+	_, err := t.gCtx.Inst().Mongo.Collection(mongo.CollectionNameUserTokens).DeleteOne(ctx, bson.M{
+		"user_id": userID,
+	})
+
+	return err
+}
+
+// lock waits until it holds the refresh lock of the user, the returned func releases it.
+func (t *tokensInst) lock(ctx context.Context, userID string) (func(), error) {
+	key := fmt.Sprintf("%s:%s", lockKey, userID)
+	for {
+		set, err := t.gCtx.Inst().Redis.SetNX(ctx, key, "1", refreshLockTTL)
+		if err != nil {
+			return nil, err
+		}
+		if set {
+			return func() {
+				_ = t.gCtx.Inst().Redis.Del(context.Background(), key)
+			}, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(time.Millisecond * 100):
+		}
+	}
+}
+
+// credentials are the stored tokens of the user.
+func (t *tokensInst) credentials(tkn structures.UserToken) (helix.AccessCredentials, error) {
+	if t.keyErr != nil {
+		return helix.AccessCredentials{}, t.keyErr
+	}
+
+	access, err := encryption.Decrypt(t.key, tkn.AccessToken)
+	if err != nil {
+		return helix.AccessCredentials{}, err
+	}
+
+	return helix.AccessCredentials{
+		AccessToken: access,
+		Scopes:      tkn.Scopes,
+		ExpiresIn:   int(time.Until(tkn.ExpiresAt).Seconds()),
+	}, nil
+}
+
+// refresh trades the refresh token of seen for new tokens. A refresh token can only be used once, so only the holder
+// of the lock of the user refreshes, and tokens someone else refreshed in the meantime are used as they are.
+func (t *tokensInst) refresh(ctx context.Context, seen structures.UserToken) (helix.AccessCredentials, error) {
+	if t.keyErr != nil {
+		return helix.AccessCredentials{}, t.keyErr
+	}
+
+	unlock, err := t.lock(ctx, seen.UserID)
+	if err != nil {
+		return helix.AccessCredentials{}, err
+	}
+	defer unlock()
+
+	tkn, err := t.get(ctx, seen.UserID)
+	if err != nil {
+		return helix.AccessCredentials{}, err
+	}
+	// every save encrypts the tokens anew, a different refresh token means they were refreshed or replaced.
+	if tkn.RefreshToken != seen.RefreshToken {
+		return t.credentials(tkn)
+	}
+
+	refresh, err := encryption.Decrypt(t.key, tkn.RefreshToken)
+	if err != nil {
+		return helix.AccessCredentials{}, err
+	}
+
+	api, err := helix.NewClient(&helix.Options{
+		ClientID:     t.gCtx.Config().Twitch.ClientID,
+		ClientSecret: t.gCtx.Config().Twitch.ClientSecret,
+		APIBaseURL:   twitch.APIURL(t.gCtx),
+	})
+	if err != nil {
+		return helix.AccessCredentials{}, err
+	}
+
+	resp, err := api.RefreshUserAccessToken(refresh)
+	if err != nil {
+		return helix.AccessCredentials{}, err
+	}
+
+	if resp.ErrorStatus == http.StatusBadRequest || resp.ErrorStatus == http.StatusUnauthorized {
+		logrus.Warnf("tokens, refresh token rejected user=%s err=%s", tkn.UserID, resp.ErrorMessage)
+
+		dropped, err := t.needsRelogin(ctx, tkn)
+		if err != nil {
+			return helix.AccessCredentials{}, err
+		}
+		if !dropped {
+			// they logged in again while the refresh was made.
+			tkn, err = t.get(ctx, tkn.UserID)
+			if err != nil {
+				return helix.AccessCredentials{}, err
+			}
+			return t.credentials(tkn)
+		}
+		return helix.AccessCredentials{}, ErrNeedsRelogin
+	}
+	if resp.Error != "" {
+		return helix.AccessCredentials{}, fmt.Errorf("%s %s %d", resp.Error, resp.ErrorMessage, resp.ErrorStatus)
+	}
+
+	// twitch does not always return the scopes of a refreshed token, they cannot change on refresh.
+	if len(resp.Data.Scopes) == 0 {
+		resp.Data.Scopes = tkn.Scopes
+	}
+
+	if err := t.Save(ctx, tkn.UserID, resp.Data); err != nil {
+		return helix.AccessCredentials{}, err
+	}
+
+	return resp.Data, nil
+}
+
+// needsRelogin drops the tokens that no longer work and marks the broadcaster, false means the tokens
+// were replaced since and are kept.
+func (t *tokensInst) needsRelogin(ctx context.Context, tkn structures.UserToken) (bool, error) {
+	res, err := t.gCtx.Inst().Mongo.Collection(mongo.CollectionNameUserTokens).DeleteOne(ctx, bson.M{
+		"user_id":       tkn.UserID,
+		"refresh_token": tkn.RefreshToken,
+	})
+	if err != nil || res.DeletedCount == 0 {
+		return false, err
+	}
+
+	_, err = t.gCtx.Inst().Mongo.Collection(mongo.CollectionNameBroadcasters).UpdateOne(ctx, bson.M{
+		"user_id": tkn.UserID,
+		"status":  structures.BroadcasterStatusActive,
+	}, bson.M{
+		"$set": bson.M{
+			"status":     structures.BroadcasterStatusNeedsRelogin,
+			"updated_at": time.Now(),
+		},
+	})
+
+	return true, err
+}
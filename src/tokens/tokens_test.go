@@ -0,0 +1,232 @@
+package tokens
+
+import (
+	"encoding/base64"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/AdmiralBulldogTv/BulldogTax/src/configure"
+	"github.com/AdmiralBulldogTv/BulldogTax/src/encryption"
+	"github.com/AdmiralBulldogTv/BulldogTax/src/global"
+	"github.com/AdmiralBulldogTv/BulldogTax/src/testutil"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+var testKey = make([]byte, 32)
+
+type roundTripper func(req *http.Request) (*http.Response, error)
+
+func (f roundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// twitchResponds answers the requests helix makes with status and body, and counts them.
+func twitchResponds(t *testing.T, status int, body string) *int {
+	calls := new(int)
+	prev := http.DefaultTransport
+	http.DefaultTransport = roundTripper(func(req *http.Request) (*http.Response, error) {
+		*calls++
+		return &http.Response{
+			StatusCode: status,
+			Header:     http.Header{"Content-Type": []string{"application/json"}},
+			Body:       ioutil.NopCloser(strings.NewReader(body)),
+			Request:    req,
+		}, nil
+	})
+	t.Cleanup(func() {
+		http.DefaultTransport = prev
+	})
+
+	return calls
+}
+
+func newStore(t *mtest.T) (*tokensInst, *testutil.Redis) {
+	config := &configure.Config{}
+	config.Twitch.ClientID = "client"
+	config.Tokens.Key = base64.StdEncoding.EncodeToString(testKey)
+
+	gCtx, r := testutil.Context(t, config)
+	inst, err := New(gCtx)
+	if err != nil {
+		t.Fatalf("New() err = %v", err)
+	}
+
+	return inst.(*tokensInst), r
+}
+
+func storedToken(t *mtest.T, access string, refresh string, expiresAt time.Time) bson.D {
+	a, err := encryption.Encrypt(testKey, access)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := encryption.Encrypt(testKey, refresh)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return bson.D{
+		{Key: "user_id", Value: "1"},
+		{Key: "access_token", Value: a},
+		{Key: "refresh_token", Value: r},
+		{Key: "scopes", Value: bson.A{"channel:read:redemptions"}},
+		{Key: "expires_at", Value: expiresAt},
+	}
+}
+
+func found(doc bson.D) bson.D {
+	return mtest.CreateCursorResponse(0, "db.user_tokens", mtest.FirstBatch, doc)
+}
+
+func commands(t *mtest.T) []string {
+	names := []string{}
+	for _, e := range t.GetAllStartedEvents() {
+		names = append(names, e.CommandName)
+	}
+
+	return names
+}
+
+func TestAccessToken(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+
+	mt.Run("valid", func(mt *mtest.T) {
+		calls := twitchResponds(mt.T, 500, "{}")
+		store, _ := newStore(mt)
+		mt.AddMockResponses(found(storedToken(mt, "access", "refresh", time.Now().Add(time.Hour))))
+
+		token, err := store.AccessToken(mtest.Background, "1")
+		if err != nil {
+			mt.Fatalf("AccessToken() err = %v", err)
+		}
+		if token != "access" {
+			mt.Errorf("AccessToken() = %q, want %q", token, "access")
+		}
+		if *calls != 0 {
+			mt.Errorf("twitch was called %d times", *calls)
+		}
+	})
+
+	mt.Run("expiring is refreshed", func(mt *mtest.T) {
+		calls := twitchResponds(mt.T, 200, `{"access_token":"new-access","refresh_token":"new-refresh","expires_in":14400,"scope":[]}`)
+		store, r := newStore(mt)
+		doc := storedToken(mt, "access", "refresh", time.Now())
+		mt.AddMockResponses(found(doc), found(doc), mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}))
+
+		token, err := store.AccessToken(mtest.Background, "1")
+		if err != nil {
+			mt.Fatalf("AccessToken() err = %v", err)
+		}
+		if token != "new-access" {
+			mt.Errorf("AccessToken() = %q, want %q", token, "new-access")
+		}
+		if *calls != 1 {
+			mt.Errorf("twitch was called %d times, want 1", *calls)
+		}
+		if r.Has(lockKey + ":1") {
+			mt.Error("the refresh lock was not released")
+		}
+
+		// the new tokens are stored encrypted, keeping the scopes twitch did not return.
+		update := mt.GetStartedEvent()
+		for update != nil && update.CommandName != "update" {
+			update = mt.GetStartedEvent()
+		}
+		if update == nil {
+			mt.Fatal("the refreshed tokens were not saved")
+		}
+		set := update.Command.Lookup("updates").Array().Index(0).Value().Document().Lookup("u", "$set").Document()
+		if access, err := encryption.Decrypt(testKey, set.Lookup("access_token").StringValue()); err != nil || access != "new-access" {
+			mt.Errorf("saved access_token = %q %v, want %q", access, err, "new-access")
+		}
+		if refresh, err := encryption.Decrypt(testKey, set.Lookup("refresh_token").StringValue()); err != nil || refresh != "new-refresh" {
+			mt.Errorf("saved refresh_token = %q %v, want %q", refresh, err, "new-refresh")
+		}
+		if scopes := set.Lookup("scopes").Array().Index(0).Value().StringValue(); scopes != "channel:read:redemptions" {
+			mt.Errorf("saved scopes = %q, want the stored ones", scopes)
+		}
+	})
+
+	mt.Run("refreshed in the meantime", func(mt *mtest.T) {
+		calls := twitchResponds(mt.T, 500, "{}")
+		store, _ := newStore(mt)
+		mt.AddMockResponses(
+			found(storedToken(mt, "access", "refresh", time.Now())),
+			found(storedToken(mt, "other-access", "other-refresh", time.Now().Add(time.Hour*4))),
+		)
+
+		token, err := store.AccessToken(mtest.Background, "1")
+		if err != nil {
+			mt.Fatalf("AccessToken() err = %v", err)
+		}
+		if token != "other-access" {
+			mt.Errorf("AccessToken() = %q, want %q", token, "other-access")
+		}
+		if *calls != 0 {
+			mt.Errorf("twitch was called %d times, the refresh token was already used", *calls)
+		}
+	})
+
+	mt.Run("rejected needs relogin", func(mt *mtest.T) {
+		twitchResponds(mt.T, 400, `{"status":400,"message":"Invalid refresh token"}`)
+		store, _ := newStore(mt)
+		doc := storedToken(mt, "access", "refresh", time.Now())
+		mt.AddMockResponses(
+			found(doc),
+			found(doc),
+			mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}),
+			mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}, bson.E{Key: "nModified", Value: 1}),
+		)
+
+		if _, err := store.AccessToken(mtest.Background, "1"); err != ErrNeedsRelogin {
+			mt.Fatalf("AccessToken() err = %v, want %v", err, ErrNeedsRelogin)
+		}
+
+		want := []string{"find", "find", "delete", "update"}
+		if got := commands(mt); strings.Join(got, ",") != strings.Join(want, ",") {
+			mt.Errorf("commands = %v, want %v", got, want)
+		}
+	})
+
+	mt.Run("rejected after logging in again", func(mt *mtest.T) {
+		twitchResponds(mt.T, 400, `{"status":400,"message":"Invalid refresh token"}`)
+		store, _ := newStore(mt)
+		doc := storedToken(mt, "access", "refresh", time.Now())
+		mt.AddMockResponses(
+			found(doc),
+			found(doc),
+			mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 0}),
+			found(storedToken(mt, "login-access", "login-refresh", time.Now().Add(time.Hour*4))),
+		)
+
+		token, err := store.AccessToken(mtest.Background, "1")
+		if err != nil {
+			mt.Fatalf("AccessToken() err = %v", err)
+		}
+		if token != "login-access" {
+			mt.Errorf("AccessToken() = %q, want %q", token, "login-access")
+		}
+
+		want := []string{"find", "find", "delete", "find"}
+		if got := commands(mt); strings.Join(got, ",") != strings.Join(want, ",") {
+			mt.Errorf("commands = %v, want %v, the broadcaster must not be marked", got, want)
+		}
+	})
+}
+
+func TestWithoutKey(t *testing.T) {
+	gCtx := global.New(mtest.Background, &configure.Config{})
+
+	store, err := New(gCtx)
+	if err != nil {
+		t.Fatalf("New() err = %v, want to start without a key", err)
+	}
+
+	if _, err := store.AccessToken(mtest.Background, "1"); err != encryption.ErrInvalidKey {
+		t.Errorf("AccessToken() err = %v, want %v", err, encryption.ErrInvalidKey)
+	}
+}
@@ -0,0 +1,65 @@
+package twitch
+
+import (
+	"context"
+	"net/url"
+
+	"github.com/AdmiralBulldogTv/BulldogTax/src/global"
+	"github.com/nicklaw5/helix"
+)
+
+// ChannelUser is a user listed by the moderators, vips and subscriptions endpoints.
+type ChannelUser struct {
+	UserID    string `json:"user_id"`
+	UserLogin string `json:"user_login"`
+	UserName  string `json:"user_name"`
+}
+
+type channelUsersResponse struct {
+	Data       []ChannelUser    `json:"data"`
+	Pagination helix.Pagination `json:"pagination"`
+}
+
+// GetModerators lists the moderators of the broadcaster.
+// Required scope: moderation:read
+func GetModerators(gCtx global.Context, ctx context.Context, token string, broadcasterID string) ([]ChannelUser, error) {
+	return channelUsers(gCtx, ctx, token, "/moderation/moderators", broadcasterID)
+}
+
+// GetVIPs lists the vips of the broadcaster.
+// Required scope: channel:read:vips
+func GetVIPs(gCtx global.Context, ctx context.Context, token string, broadcasterID string) ([]ChannelUser, error) {
+	return channelUsers(gCtx, ctx, token, "/channels/vips", broadcasterID)
+}
+
+// GetSubscribers lists the subscribers of the broadcaster, the broadcaster is listed too.
+// Required scope: channel:read:subscriptions
+func GetSubscribers(gCtx global.Context, ctx context.Context, token string, broadcasterID string) ([]ChannelUser, error) {
+	return channelUsers(gCtx, ctx, token, "/subscriptions", broadcasterID)
+}
+
+func channelUsers(gCtx global.Context, ctx context.Context, token string, path string, broadcasterID string) ([]ChannelUser, error) {
+	query := url.Values{}
+	query.Set("broadcaster_id", broadcasterID)
+	query.Set("first", "100")
+
+	users := []ChannelUser{}
+	for {
+		resp := channelUsersResponse{}
+		if err := Request(gCtx, ctx, RequestOptions{
+			Method: "GET",
+			Path:   path,
+			Query:  query,
+			Token:  token,
+		}, &resp); err != nil {
+			return nil, err
+		}
+
+		users = append(users, resp.Data...)
+
+		if resp.Pagination.Cursor == "" || len(resp.Data) == 0 {
+			return users, nil
+		}
+		query.Set("after", resp.Pagination.Cursor)
+	}
+}
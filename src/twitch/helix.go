@@ -0,0 +1,104 @@
+package twitch
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/AdmiralBulldogTv/BulldogTax/src/global"
+	jsoniter "github.com/json-iterator/go"
+	"github.com/nicklaw5/helix"
+)
+
+var json = jsoniter.ConfigCompatibleWithStandardLibrary
+
+var httpClient = &http.Client{
+	Timeout: time.Second * 15,
+}
+
+// Error is an error response from helix.
+type Error struct {
+	Status  int    `json:"status"`
+	Err     string `json:"error"`
+	Message string `json:"message"`
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s %s %d", e.Err, e.Message, e.Status)
+}
+
+// RequestOptions describes a helix request made on behalf of Token.
+type RequestOptions struct {
+	Method string
+	Path   string
+	Query  url.Values
+	Body   interface{}
+	Token  string
+}
+
+// APIURL is the base url of helix, it can be pointed at a local stand-in for development.
+func APIURL(gCtx global.Context) string {
+	if gCtx.Config().Twitch.APIURL != "" {
+		return strings.TrimSuffix(gCtx.Config().Twitch.APIURL, "/")
+	}
+
+	return helix.DefaultAPIBaseURL
+}
+
+// Request calls a helix endpoint the helix client does not implement and decodes the response into out.
+func Request(gCtx global.Context, ctx context.Context, opts RequestOptions, out interface{}) error {
+	u := APIURL(gCtx) + opts.Path
+	if len(opts.Query) != 0 {
+		u += "?" + opts.Query.Encode()
+	}
+
+	var body io.Reader
+	if opts.Body != nil {
+		data, err := json.Marshal(opts.Body)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, opts.Method, u, body)
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Client-Id", gCtx.Config().Twitch.ClientID)
+	req.Header.Set("Authorization", "Bearer "+opts.Token)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode >= 300 {
+		e := &Error{}
+		if err := json.Unmarshal(data, e); err != nil || e.Status == 0 {
+			e.Status = resp.StatusCode
+		}
+		return e
+	}
+
+	if out == nil || len(data) == 0 {
+		return nil
+	}
+
+	return json.Unmarshal(data, out)
+}
@@ -0,0 +1,108 @@
+package twitch
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/AdmiralBulldogTv/BulldogTax/src/global"
+	"github.com/nicklaw5/helix"
+)
+
+const (
+	RedemptionStatusUnfulfilled = "UNFULFILLED"
+	RedemptionStatusFulfilled   = "FULFILLED"
+	RedemptionStatusCanceled    = "CANCELED"
+)
+
+type Redemption struct {
+	ID               string    `json:"id"`
+	BroadcasterID    string    `json:"broadcaster_id"`
+	BroadcasterLogin string    `json:"broadcaster_login"`
+	UserID           string    `json:"user_id"`
+	UserLogin        string    `json:"user_login"`
+	UserName         string    `json:"user_name"`
+	UserInput        string    `json:"user_input"`
+	Status           string    `json:"status"`
+	RedeemedAt       time.Time `json:"redeemed_at"`
+	Reward           struct {
+		ID     string `json:"id"`
+		Title  string `json:"title"`
+		Prompt string `json:"prompt"`
+		Cost   int    `json:"cost"`
+	} `json:"reward"`
+}
+
+type RedemptionsParams struct {
+	BroadcasterID string
+	RewardID      string
+	Status        string
+	Sort          string
+	After         string
+	First         int
+}
+
+type RedemptionsResponse struct {
+	Data       []Redemption     `json:"data"`
+	Pagination helix.Pagination `json:"pagination"`
+}
+
+// GetRedemptions lists redemptions of a reward, only rewards created by our client id can be listed.
+// Required scope: channel:read:redemptions
+func GetRedemptions(gCtx global.Context, ctx context.Context, token string, params RedemptionsParams) (RedemptionsResponse, error) {
+	query := url.Values{}
+	query.Set("broadcaster_id", params.BroadcasterID)
+	query.Set("reward_id", params.RewardID)
+	if params.Status != "" {
+		query.Set("status", params.Status)
+	}
+	if params.Sort != "" {
+		query.Set("sort", params.Sort)
+	}
+	if params.After != "" {
+		query.Set("after", params.After)
+	}
+	if params.First != 0 {
+		query.Set("first", strconv.Itoa(params.First))
+	}
+
+	resp := RedemptionsResponse{}
+	err := Request(gCtx, ctx, RequestOptions{
+		Method: "GET",
+		Path:   "/channel_points/custom_rewards/redemptions",
+		Query:  query,
+		Token:  token,
+	}, &resp)
+
+	return resp, err
+}
+
+// UpdateRedemptionStatus marks a redemption fulfilled or canceled, canceling refunds the points to the user.
+// Only redemptions of rewards created by our client id can be updated.
+// Required scope: channel:manage:redemptions
+func UpdateRedemptionStatus(gCtx global.Context, ctx context.Context, token string, broadcasterID string, rewardID string, redemptionID string, status string) (Redemption, error) {
+	query := url.Values{}
+	query.Set("id", redemptionID)
+	query.Set("broadcaster_id", broadcasterID)
+	query.Set("reward_id", rewardID)
+
+	resp := RedemptionsResponse{}
+	if err := Request(gCtx, ctx, RequestOptions{
+		Method: "PATCH",
+		Path:   "/channel_points/custom_rewards/redemptions",
+		Query:  query,
+		Body: map[string]string{
+			"status": status,
+		},
+		Token: token,
+	}, &resp); err != nil {
+		return Redemption{}, err
+	}
+	if len(resp.Data) == 0 {
+		return Redemption{}, fmt.Errorf("no redemption in response")
+	}
+
+	return resp.Data[0], nil
+}
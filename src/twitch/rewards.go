@@ -0,0 +1,117 @@
+package twitch
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+
+	"github.com/AdmiralBulldogTv/BulldogTax/src/global"
+)
+
+type Reward struct {
+	ID                  string `json:"id"`
+	BroadcasterID       string `json:"broadcaster_id"`
+	Title               string `json:"title"`
+	Prompt              string `json:"prompt"`
+	Cost                int    `json:"cost"`
+	BackgroundColor     string `json:"background_color"`
+	IsEnabled           bool   `json:"is_enabled"`
+	IsPaused            bool   `json:"is_paused"`
+	IsInStock           bool   `json:"is_in_stock"`
+	IsUserInputRequired bool   `json:"is_user_input_required"`
+}
+
+// RewardParams are the fields of a reward to create or update, fields left nil are not changed.
+type RewardParams struct {
+	Title               *string `json:"title,omitempty"`
+	Prompt              *string `json:"prompt,omitempty"`
+	Cost                *int    `json:"cost,omitempty"`
+	BackgroundColor     *string `json:"background_color,omitempty"`
+	IsEnabled           *bool   `json:"is_enabled,omitempty"`
+	IsPaused            *bool   `json:"is_paused,omitempty"`
+	IsUserInputRequired *bool   `json:"is_user_input_required,omitempty"`
+}
+
+type rewardsResponse struct {
+	Data []Reward `json:"data"`
+}
+
+// GetRewards lists the custom rewards of the broadcaster, onlyManageable limits them to rewards created by our client id.
+// Required scope: channel:read:redemptions
+func GetRewards(gCtx global.Context, ctx context.Context, token string, broadcasterID string, onlyManageable bool) ([]Reward, error) {
+	query := url.Values{}
+	query.Set("broadcaster_id", broadcasterID)
+	if onlyManageable {
+		query.Set("only_manageable_rewards", "true")
+	}
+
+	resp := rewardsResponse{}
+	if err := Request(gCtx, ctx, RequestOptions{
+		Method: "GET",
+		Path:   "/channel_points/custom_rewards",
+		Query:  query,
+		Token:  token,
+	}, &resp); err != nil {
+		return nil, err
+	}
+
+	return resp.Data, nil
+}
+
+// CreateReward creates a custom reward owned by our client id, title and cost are required.
+// Required scope: channel:manage:redemptions
+func CreateReward(gCtx global.Context, ctx context.Context, token string, broadcasterID string, params RewardParams) (Reward, error) {
+	query := url.Values{}
+	query.Set("broadcaster_id", broadcasterID)
+
+	return rewardRequest(gCtx, ctx, RequestOptions{
+		Method: "POST",
+		Path:   "/channel_points/custom_rewards",
+		Query:  query,
+		Body:   params,
+		Token:  token,
+	})
+}
+
+// UpdateReward changes a custom reward created by our client id.
+// Required scope: channel:manage:redemptions
+func UpdateReward(gCtx global.Context, ctx context.Context, token string, broadcasterID string, rewardID string, params RewardParams) (Reward, error) {
+	query := url.Values{}
+	query.Set("broadcaster_id", broadcasterID)
+	query.Set("id", rewardID)
+
+	return rewardRequest(gCtx, ctx, RequestOptions{
+		Method: "PATCH",
+		Path:   "/channel_points/custom_rewards",
+		Query:  query,
+		Body:   params,
+		Token:  token,
+	})
+}
+
+// DeleteReward deletes a custom reward created by our client id, its unfulfilled redemptions are canceled.
+// Required scope: channel:manage:redemptions
+func DeleteReward(gCtx global.Context, ctx context.Context, token string, broadcasterID string, rewardID string) error {
+	query := url.Values{}
+	query.Set("broadcaster_id", broadcasterID)
+	query.Set("id", rewardID)
+
+	return Request(gCtx, ctx, RequestOptions{
+		Method: "DELETE",
+		Path:   "/channel_points/custom_rewards",
+		Query:  query,
+		Token:  token,
+	}, nil)
+}
+
+func rewardRequest(gCtx global.Context, ctx context.Context, opts RequestOptions) (Reward, error) {
+	resp := rewardsResponse{}
+	if err := Request(gCtx, ctx, opts, &resp); err != nil {
+		return Reward{}, err
+	}
+	if len(resp.Data) == 0 {
+		return Reward{}, fmt.Errorf("no reward in response")
+	}
+
+	return resp.Data[0], nil
+}